@@ -0,0 +1,100 @@
+package flightsql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// adhocFiltersMacro matches the macro expanded into the predicates of the
+// ad-hoc filters of a query.
+var adhocFiltersMacro = regexp.MustCompile(`\$__adhocFilters\b`)
+
+// adhocFilter is a filter of an ad-hoc filters template variable.
+type adhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// adhocOperators maps the operators of ad-hoc filters to their SQL operator.
+var adhocOperators = map[string]string{
+	"=":  "=",
+	"!=": "<>",
+	"<":  "<",
+	">":  ">",
+	"=~": "~",
+	"!~": "!~",
+}
+
+// sql returns the filter as a SQL predicate. The key is quoted as an
+// identifier with quote. Values of = and != are compared as strings and values
+// of < and > as numbers if they are decimal numbers. Regex values are anchored
+// to match the whole value as ad-hoc filters do in other datasources.
+func (f adhocFilter) sql(quote string) (string, error) {
+	op, ok := adhocOperators[f.Operator]
+	if !ok {
+		return "", fmt.Errorf("unsupported ad-hoc filter operator: %q", f.Operator)
+	}
+	if f.Key == "" {
+		return "", fmt.Errorf("ad-hoc filter without a key")
+	}
+
+	value := f.Value
+	switch f.Operator {
+	case "=~", "!~":
+		if _, err := regexp.Compile(value); err != nil {
+			return "", fmt.Errorf("ad-hoc filter on %s: %w", f.Key, err)
+		}
+		value = "^(?:" + value + ")$"
+	case "<", ">":
+		if decimalLiteral.MatchString(value) {
+			return fmt.Sprintf("%s %s %s", quoteIdentifier(f.Key, quote), op, value), nil
+		}
+	}
+	return fmt.Sprintf("%s %s '%s'", quoteIdentifier(f.Key, quote), op, strings.ReplaceAll(value, "'", "''")), nil
+}
+
+// adhocFiltersSQL returns the predicate matching the rows that pass all the
+// filters, with keys quoted with quote. Without filters every row passes.
+func adhocFiltersSQL(filters []adhocFilter, quote string) (string, error) {
+	if len(filters) == 0 {
+		return "1 = 1", nil
+	}
+	predicates := make([]string, len(filters))
+	for i, f := range filters {
+		p, err := f.sql(quote)
+		if err != nil {
+			return "", err
+		}
+		predicates[i] = p
+	}
+	return strings.Join(predicates, " and "), nil
+}
+
+// wrapAdhocFilters returns the text of a query wrapped in a query applying
+// its ad-hoc filters to its results. Queries without filters or already using
+// $__adhocFilters are returned as is.
+func wrapAdhocFilters(text string, filters []adhocFilter) (string, error) {
+	if len(filters) == 0 || adhocFiltersMacro.MatchString(text) {
+		return text, nil
+	}
+	statements := splitStatements(text)
+	if len(statements) != 1 {
+		return "", fmt.Errorf("ad-hoc filters can only be applied automatically to a single statement")
+	}
+	return fmt.Sprintf("select * from (%s) as filtered where $__adhocFilters", statements[0].Text), nil
+}
+
+// expandAdhocFilters expands the $__adhocFilters macro in text, quoting keys
+// with quote.
+func expandAdhocFilters(text string, filters []adhocFilter, quote string) (string, error) {
+	if !adhocFiltersMacro.MatchString(text) {
+		return text, nil
+	}
+	sql, err := adhocFiltersSQL(filters, quote)
+	if err != nil {
+		return "", err
+	}
+	return adhocFiltersMacro.ReplaceAllLiteralString(text, sql), nil
+}
@@ -0,0 +1,126 @@
+package flightsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdhocFilterSQL(t *testing.T) {
+	cs := []struct {
+		filter adhocFilter
+		out    string
+	}{
+		{adhocFilter{Key: "host", Operator: "=", Value: "a"}, `"host" = 'a'`},
+		{adhocFilter{Key: "host", Operator: "!=", Value: "it's"}, `"host" <> 'it''s'`},
+		{adhocFilter{Key: "code", Operator: "=", Value: "200"}, `"code" = '200'`},
+		{adhocFilter{Key: "cpu", Operator: "<", Value: "0.5"}, `"cpu" < 0.5`},
+		{adhocFilter{Key: "version", Operator: ">", Value: "v1"}, `"version" > 'v1'`},
+		{adhocFilter{Key: "cpu", Operator: ">", Value: "NaN"}, `"cpu" > 'NaN'`},
+		{adhocFilter{Key: "cpu", Operator: "<", Value: "Inf"}, `"cpu" < 'Inf'`},
+		{adhocFilter{Key: "cpu", Operator: "<", Value: "0x1p-2"}, `"cpu" < '0x1p-2'`},
+		{adhocFilter{Key: "host", Operator: "=~", Value: "web-.*"}, `"host" ~ '^(?:web-.*)$'`},
+		{adhocFilter{Key: "host", Operator: "!~", Value: "a|b"}, `"host" !~ '^(?:a|b)$'`},
+		{adhocFilter{Key: `my "col"`, Operator: "=", Value: "a"}, `"my ""col""" = 'a'`},
+	}
+	for _, c := range cs {
+		t.Run(c.out, func(t *testing.T) {
+			sql, err := c.filter.sql(defaultIdentifierQuote)
+			require.NoError(t, err)
+			require.Equal(t, c.out, sql)
+		})
+	}
+
+	_, err := adhocFilter{Key: "host", Operator: "<>", Value: "a"}.sql(defaultIdentifierQuote)
+	require.EqualError(t, err, `unsupported ad-hoc filter operator: "<>"`)
+	_, err = adhocFilter{Operator: "=", Value: "a"}.sql(defaultIdentifierQuote)
+	require.EqualError(t, err, "ad-hoc filter without a key")
+	_, err = adhocFilter{Key: "host", Operator: "=~", Value: "("}.sql(defaultIdentifierQuote)
+	require.ErrorContains(t, err, "ad-hoc filter on host")
+}
+
+func TestAdhocFiltersSQL(t *testing.T) {
+	sql, err := adhocFiltersSQL(nil, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, "1 = 1", sql)
+
+	sql, err = adhocFiltersSQL([]adhocFilter{
+		{Key: "host", Operator: "=", Value: "a"},
+		{Key: "cpu", Operator: ">", Value: "1"},
+	}, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `"host" = 'a' and "cpu" > 1`, sql)
+}
+
+func TestWrapAdhocFilters(t *testing.T) {
+	filters := []adhocFilter{{Key: "host", Operator: "=", Value: "a"}}
+
+	text, err := wrapAdhocFilters("select * from x;", filters)
+	require.NoError(t, err)
+	require.Equal(t, "select * from (select * from x) as filtered where $__adhocFilters", text)
+
+	text, err = wrapAdhocFilters("select * from x where $__adhocFilters", filters)
+	require.NoError(t, err)
+	require.Equal(t, "select * from x where $__adhocFilters", text)
+
+	text, err = wrapAdhocFilters("select * from x", nil)
+	require.NoError(t, err)
+	require.Equal(t, "select * from x", text)
+
+	_, err = wrapAdhocFilters("select 1; select 2", filters)
+	require.Error(t, err)
+}
+
+func TestInterpolate_AdhocFilters(t *testing.T) {
+	query := queryModel{
+		Text:         "select * from x where $__adhocFilters and time >= $__timeFrom",
+		AdhocFilters: []adhocFilter{{Key: "host", Operator: "=", Value: "$__timeFrom"}},
+	}
+	query, err := query.interpolate()
+	require.NoError(t, err)
+	// Macros in the values of filters are not expanded.
+	require.Equal(t, `select * from x where "host" = '$__timeFrom' and time >= cast('0001-01-01T00:00:00Z' as timestamp)`, query.RawSQL)
+}
+
+func TestIntegration_QueryData_AdhocFilters(t *testing.T) {
+	ds := newTestDatasource(t, config{}, logsTable...)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	query := queryRequest{
+		RefID:  "A",
+		Text:   "select message from logs where $__adhocFilters",
+		Format: "table",
+		AdhocFilters: []adhocFilter{
+			{Key: "level", Operator: "=", Value: "info"},
+			{Key: "ts", Operator: ">", Value: "1672531200"},
+		},
+	}
+
+	resp := queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Equal(t, []*string{ptr("stopped")}, extractFieldValues[*string](t, resp.Frames[0].Fields[0]))
+
+	query.Text = "select message, level, ts from logs"
+	query.WrapAdhocFilters = true
+	resp = queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Equal(t, []*string{ptr("stopped")}, extractFieldValues[*string](t, resp.Frames[0].Fields[0]))
+
+	// The filters apply to the log lines counted by logs volume queries.
+	query.Format = "logs"
+	query.QueryType = string(queryTypeLogsVolume)
+	query.TimeColumn = "ts"
+	query.TimeUnit = "s"
+	query.SeverityColumn = "level"
+	resp = queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames[0].Fields, 2)
+	require.Equal(t, []int64{1}, extractFieldValues[int64](t, resp.Frames[0].Fields[1]))
+
+	query.AdhocFilters = []adhocFilter{{Key: "level", Operator: "like", Value: "info"}}
+	resp = queryDataResponse(t, ds, query, tr)
+	require.EqualError(t, resp.Error, `unsupported ad-hoc filter operator: "like"`)
+}
@@ -32,12 +32,21 @@ type recordReader interface {
 // newQueryDataResponse builds a [backend.DataResponse] from a stream of
 // [arrow.Record]s.
 //
-// The backend.DataResponse contains a single [data.Frame].
-func newQueryDataResponse(reader recordReader, query sqlutil.Query, headers metadata.MD) backend.DataResponse {
-	var resp backend.DataResponse
+// The records are read into a single [data.Frame], which the format of the
+// query may convert into several frames, such as one per series for
+// time_series_multi or the nodes and edges of node_graph.
+func newQueryDataResponse(reader recordReader, query queryModel, headers metadata.MD) backend.DataResponse {
 	frame, err := frameForRecords(reader)
-	if err != nil {
-		resp.Error = err
+	return frameDataResponse(frame, err, query, headers)
+}
+
+// frameDataResponse builds a [backend.DataResponse] from a frame of query
+// results, converting it to the format requested by the query. readErr is an
+// error encountered while reading the results into the frame.
+func frameDataResponse(frame *data.Frame, readErr error, query queryModel, headers metadata.MD) backend.DataResponse {
+	var resp backend.DataResponse
+	if readErr != nil {
+		resp.Error = readErr
 	}
 	if frame.Rows() == 0 {
 		resp.Frames = data.Frames{}
@@ -50,31 +59,114 @@ func newQueryDataResponse(reader recordReader, query sqlutil.Query, headers meta
 	frame.Meta.ExecutedQueryString = query.RawSQL
 	frame.Meta.DataTopic = data.DataTopic(query.RawSQL)
 
+	// Formats returning more than one frame set frames.
+	var frames data.Frames
 	switch query.Format {
-	case sqlutil.FormatOptionTimeSeries:
-		if _, idx := frame.FieldByName("time"); idx == -1 {
-			resp.Error = fmt.Errorf("no time column found")
+	case sqlutil.FormatOptionTimeSeries, formatOptionTimeSeriesMulti:
+		var err error
+		frame, err = prepareTimeField(frame, query)
+		if err != nil {
+			resp.Error = err
+			return resp
+		}
+		frame, err = sortTimeSeries(frame)
+		if err != nil {
+			resp.Error = err
+			return resp
+		}
+		frame, err = dedupeTimeSeries(frame, query)
+		if err != nil {
+			resp.Error = err
 			return resp
 		}
 
+		if query.Format == formatOptionTimeSeriesMulti {
+			frames = splitTimeSeries(frame)
+			if query.Fill != fillModeNone {
+				for i := range frames {
+					frames[i], err = fillTimeSeries(frames[i], query)
+					if err != nil {
+						resp.Error = err
+						return resp
+					}
+				}
+			}
+			break
+		}
+
 		if frame.TimeSeriesSchema().Type == data.TimeSeriesTypeLong {
-			var err error
-			frame, err = data.LongToWide(frame, nil)
+			var fillMissing *data.FillMissing
+			if query.Fill != fillModeNone {
+				frame = nullableValues(frame)
+				fillMissing = &data.FillMissing{Mode: data.FillModeNull}
+			}
+
+			frame, err = data.LongToWide(frame, fillMissing)
+			if err != nil {
+				resp.Error = err
+				return resp
+			}
+		}
+
+		if query.Fill != fillModeNone {
+			frame, err = fillTimeSeries(frame, query)
 			if err != nil {
 				resp.Error = err
 				return resp
 			}
 		}
 	case sqlutil.FormatOptionTable:
-		// No changes to the output. Send it as is.
+		// Tables are sent as is, except for the values of variable queries.
+		if query.QueryType == queryTypeVariable {
+			var err error
+			frame, err = variableFrame(frame, query)
+			if err != nil {
+				resp.Error = err
+				return resp
+			}
+		}
 	case sqlutil.FormatOptionLogs:
-		// TODO(brett): We need to find out what this actually is and if its
-		// worth supporting. Pass through as "table" for now.
+		var err error
+		if query.QueryType == queryTypeLogsVolume {
+			frame, err = logsVolume(frame, query)
+		} else {
+			frame, err = logsFrame(frame, query)
+		}
+		if err != nil {
+			resp.Error = err
+			return resp
+		}
+	case formatOptionTrace:
+		var err error
+		frame, err = traceFrame(frame, query)
+		if err != nil {
+			resp.Error = err
+			return resp
+		}
+	case formatOptionNodeGraph:
+		trace, err := traceFrame(frame, query)
+		if err != nil {
+			resp.Error = err
+			return resp
+		}
+		nodes, edges := nodeGraphFrames(trace)
+		frames = data.Frames{nodes, edges}
 	default:
 		resp.Error = fmt.Errorf("unsupported format")
 	}
 
-	resp.Frames = data.Frames{frame}
+	if frames == nil {
+		frames = data.Frames{frame}
+	}
+	for _, frame := range frames {
+		setFrameType(frame, query)
+		// The node graph relies on the names and display names of the
+		// fields of its nodes and edges frames.
+		if query.Format != formatOptionNodeGraph {
+			applyFrameOptions(frame, query)
+		}
+	}
+	resp.Frames = frames
 	return resp
 }
 
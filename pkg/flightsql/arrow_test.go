@@ -79,7 +79,7 @@ func TestNewQueryDataResponse(t *testing.T) {
 	reader, err := array.NewRecordReader(schema, records)
 	require.NoError(t, err)
 
-	query := sqlutil.Query{Format: sqlutil.FormatOptionTable}
+	query := queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTable}}
 	resp := newQueryDataResponse(errReader{RecordReader: reader}, query, metadata.MD{})
 	require.NoError(t, resp.Error)
 	require.Len(t, resp.Frames, 1)
@@ -200,7 +200,7 @@ func TestNewQueryDataResponse_Error(t *testing.T) {
 		RecordReader: reader,
 		err:          fmt.Errorf("explosion!"),
 	}
-	query := sqlutil.Query{Format: sqlutil.FormatOptionTable}
+	query := queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTable}}
 	resp := newQueryDataResponse(wrappedReader, query, metadata.MD{})
 	require.Error(t, resp.Error)
 	require.Equal(t, fmt.Errorf("explosion!"), resp.Error)
@@ -241,7 +241,7 @@ func TestNewQueryDataResponse_WideTable(t *testing.T) {
 	reader, err := array.NewRecordReader(schema, records)
 	require.NoError(t, err)
 
-	resp := newQueryDataResponse(errReader{RecordReader: reader}, sqlutil.Query{}, metadata.MD{})
+	resp := newQueryDataResponse(errReader{RecordReader: reader}, queryModel{}, metadata.MD{})
 	require.NoError(t, resp.Error)
 	require.Len(t, resp.Frames, 1)
 	require.Equal(t, 3, resp.Frames[0].Rows())
@@ -472,8 +472,10 @@ func TestCustomMetadata(t *testing.T) {
 	md := metadata.MD{}
 	md.Set("trace-id", "abc")
 	md.Set("trace-sampled", "true")
-	query := sqlutil.Query{
-		Format: sqlutil.FormatOptionTable,
+	query := queryModel{
+		Query: sqlutil.Query{
+			Format: sqlutil.FormatOptionTable,
+		},
 	}
 	resp := newQueryDataResponse(errReader{RecordReader: reader}, query, md)
 	require.NoError(t, resp.Error)
@@ -485,3 +487,64 @@ func TestCustomMetadata(t *testing.T) {
 		},
 	}, resp.Frames[0].Meta.Custom)
 }
+
+func TestNewQueryDataResponse_FrameOptions(t *testing.T) {
+	alloc := memory.DefaultAllocator
+	schema := arrow.NewSchema(
+		[]arrow.Field{
+			{Name: "time", Type: &arrow.TimestampType{}},
+			{Name: "host", Type: &arrow.StringType{}},
+			{Name: "value", Type: arrow.PrimitiveTypes.Float64},
+		},
+		nil,
+	)
+
+	times, _, err := array.FromJSON(
+		alloc,
+		&arrow.TimestampType{},
+		strings.NewReader(`["2023-01-01T00:00:00Z", "2023-01-01T00:00:00Z"]`),
+	)
+	require.NoError(t, err)
+	hosts, _, err := array.FromJSON(
+		alloc,
+		&arrow.StringType{},
+		strings.NewReader(`["a", "b"]`),
+	)
+	require.NoError(t, err)
+	values, _, err := array.FromJSON(
+		alloc,
+		arrow.PrimitiveTypes.Float64,
+		strings.NewReader(`[1.5, 2.5]`),
+	)
+	require.NoError(t, err)
+
+	record := array.NewRecord(schema, []arrow.Array{times, hosts, values}, -1)
+	reader, err := array.NewRecordReader(schema, []arrow.Record{record})
+	require.NoError(t, err)
+
+	decimals := uint16(2)
+	query := queryModel{
+		Query:        sqlutil.Query{RefID: "A", Format: sqlutil.FormatOptionTimeSeries},
+		FrameName:    "cpu {{__refId}}",
+		LegendFormat: "{{host}} - {{__field}}{{missing}}",
+		FieldConfig: map[string]fieldOptions{
+			"value": {Unit: "percent", Decimals: &decimals},
+		},
+	}
+	resp := newQueryDataResponse(errReader{RecordReader: reader}, query, metadata.MD{})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+
+	frame := resp.Frames[0]
+	require.Equal(t, "cpu A", frame.Name)
+	require.Len(t, frame.Fields, 3)
+	require.Nil(t, frame.Fields[0].Config)
+
+	for i, host := range []string{"a", "b"} {
+		field := frame.Fields[i+1]
+		require.Equal(t, data.Labels{"host": host}, field.Labels)
+		require.Equal(t, host+" - value", field.Config.DisplayNameFromDS)
+		require.Equal(t, "percent", field.Config.Unit)
+		require.Equal(t, &decimals, field.Config.Decimals)
+	}
+}
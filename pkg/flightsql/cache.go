@@ -0,0 +1,391 @@
+package flightsql
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// defaultCacheMaxEntries bounds the number of results held by a
+	// [queryCache] when the datasource does not configure a limit.
+	defaultCacheMaxEntries = 1000
+	// defaultCacheMaxRows bounds the total number of rows held by a
+	// [queryCache] when the datasource does not configure a limit.
+	defaultCacheMaxRows = rowLimit
+)
+
+// Values reported under the "cache" key of [data.FrameMeta.Custom].
+const (
+	cacheStatusHit    = "hit"
+	cacheStatusMiss   = "miss"
+	cacheStatusBypass = "bypass"
+)
+
+// duration is a [time.Duration] that is encoded in JSON as a Go duration
+// string such as "30s" or "5m". Plain numbers are read as seconds.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var secs float64
+		if err := json.Unmarshal(b, &secs); err != nil {
+			return fmt.Errorf("invalid duration: %s", b)
+		}
+		*d = duration(secs * float64(time.Second))
+		return nil
+	}
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = duration(secs * float64(time.Second))
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// queryCache caches formatted query results keyed by the expanded SQL of a
+// query and the options used to format them.
+type queryCache struct {
+	*lruCache[backend.DataResponse]
+
+	granularity time.Duration
+}
+
+// newQueryCache returns a [queryCache] for the datasource configuration or nil
+// if caching is disabled.
+func newQueryCache(cfg config) *queryCache {
+	if cfg.QueryCacheTTL <= 0 {
+		return nil
+	}
+	return &queryCache{
+		lruCache: newLRUCache(
+			time.Duration(cfg.QueryCacheTTL),
+			cfg.QueryCacheMaxEntries,
+			cfg.QueryCacheMaxRows,
+			responseRows,
+		),
+		granularity: time.Duration(cfg.QueryCacheGranularity),
+	}
+}
+
+// cacheKey returns the key a query's results are cached under. Responses are
+// cached after they have been formatted so the key covers the options that
+// affect the formatting along with the format and expanded SQL.
+func cacheKey(query queryModel) (string, error) {
+	options := struct {
+		FrameName    string                  `json:"frameName"`
+		LegendFormat string                  `json:"legendFormat"`
+		FieldConfig  map[string]fieldOptions `json:"fieldConfig"`
+		TimeColumn   string                  `json:"timeColumn"`
+		TimeUnit     time.Duration           `json:"timeUnit"`
+		Fill         fillMode                `json:"fill"`
+		FillValue    float64                 `json:"fillValue"`
+		Duplicates   duplicateMode           `json:"duplicates"`
+		QueryType    queryType               `json:"queryType"`
+		Body         string                  `json:"bodyColumn"`
+		Severity     string                  `json:"severityColumn"`
+		Labels       []string                `json:"labelColumns"`
+		DurationUnit time.Duration           `json:"durationUnit"`
+		Regex        string                  `json:"variableRegex"`
+		Sort         string                  `json:"variableSort"`
+		RefID        string                  `json:"refId,omitempty"`
+		Interval     time.Duration           `json:"interval,omitempty"`
+		TimeRange    *backend.TimeRange      `json:"timeRange,omitempty"`
+	}{
+		FrameName:    query.FrameName,
+		LegendFormat: query.LegendFormat,
+		FieldConfig:  query.FieldConfig,
+		TimeColumn:   query.TimeColumn,
+		TimeUnit:     query.TimeUnit,
+		Fill:         query.Fill,
+		FillValue:    query.FillValue,
+		Duplicates:   query.Duplicates,
+		QueryType:    query.QueryType,
+		Body:         query.BodyColumn,
+		Severity:     query.SeverityColumn,
+		Labels:       query.LabelColumns,
+		DurationUnit: query.DurationUnit,
+		Sort:         query.VariableSort,
+	}
+	if query.VariableRegex != nil {
+		options.Regex = query.VariableRegex.String()
+	}
+	// Frame name templates may refer to the ref ID of the query.
+	if strings.Contains(query.FrameName, "__refId") {
+		options.RefID = query.RefID
+	}
+	// Filling adds a row for every interval of the time range.
+	if query.Fill != fillModeNone {
+		options.Interval = query.Interval
+		options.TimeRange = &query.TimeRange
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%s:%s", query.Format, b, query.RawSQL), nil
+}
+
+// alignTimeRange widens the time range to the cache granularity so that
+// queries over relative time ranges expand to the same SQL between refreshes.
+func (c *queryCache) alignTimeRange(tr backend.TimeRange) backend.TimeRange {
+	if c.granularity <= 0 {
+		return tr
+	}
+	from := tr.From.Truncate(c.granularity)
+	to := tr.To.Truncate(c.granularity)
+	if to.Before(tr.To) {
+		to = to.Add(c.granularity)
+	}
+	return backend.TimeRange{From: from, To: to}
+}
+
+// get returns a copy of the cached response for key if one exists and has not
+// expired.
+func (c *queryCache) get(key string) (backend.DataResponse, bool) {
+	resp, ok := c.lruCache.get(key)
+	if !ok {
+		return resp, false
+	}
+	return copyDataResponse(resp), true
+}
+
+// set stores a response under key. Responses carrying an error are not
+// stored.
+func (c *queryCache) set(key string, resp backend.DataResponse) {
+	if resp.Error != nil {
+		return
+	}
+	c.lruCache.set(key, copyDataResponse(resp))
+}
+
+func responseRows(resp backend.DataResponse) int {
+	rows := 0
+	for _, frame := range resp.Frames {
+		rows += frame.Rows()
+	}
+	return rows
+}
+
+// lruCache is an in-memory, least recently used cache whose entries expire
+// after a fixed TTL. Its size is bounded by both the number of entries and the
+// total number of rows they hold.
+type lruCache[V any] struct {
+	ttl        time.Duration
+	maxEntries int
+	maxRows    int
+	rowsOf     func(V) int
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	rows    int
+
+	now func() time.Time
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	rows    int
+	expires time.Time
+}
+
+// newLRUCache returns an [lruCache]. Non-positive bounds are replaced by
+// defaults.
+func newLRUCache[V any](ttl time.Duration, maxEntries, maxRows int, rowsOf func(V) int) *lruCache[V] {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	if maxRows <= 0 {
+		maxRows = defaultCacheMaxRows
+	}
+	return &lruCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxRows:    maxRows,
+		rowsOf:     rowsOf,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+// get returns the value for key if one exists and has not expired.
+func (c *lruCache[V]) get(key string) (V, bool) {
+	v, _, ok := c.getWithExpiry(key)
+	return v, ok
+}
+
+// getWithExpiry is like get but also returns when the value expires.
+func (c *lruCache[V]) getWithExpiry(key string) (V, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, time.Time{}, false
+	}
+	entry := el.Value.(*cacheEntry[V])
+	if !c.now().Before(entry.expires) {
+		c.remove(el)
+		return zero, time.Time{}, false
+	}
+	c.lru.MoveToFront(el)
+	return entry.value, entry.expires, true
+}
+
+// set stores value under key, evicting the least recently used entries until
+// the bounds of the cache hold. Values exceeding the row bound on their own
+// are not stored.
+func (c *lruCache[V]) set(key string, value V) {
+	rows := c.rowsOf(value)
+	if rows > c.maxRows {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	entry := &cacheEntry[V]{
+		key:     key,
+		value:   value,
+		rows:    rows,
+		expires: c.now().Add(c.ttl),
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.rows += rows
+
+	for c.lru.Len() > c.maxEntries || c.rows > c.maxRows {
+		c.remove(c.lru.Back())
+	}
+}
+
+// delete removes the value for key if one exists.
+func (c *lruCache[V]) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// clear removes all values.
+func (c *lruCache[V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.rows = 0
+}
+
+func (c *lruCache[V]) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry[V])
+	delete(c.entries, entry.key)
+	c.rows -= entry.rows
+}
+
+// copyDataResponse returns a copy of resp whose frames can have their metadata
+// modified without affecting resp. Field values are shared.
+func copyDataResponse(resp backend.DataResponse) backend.DataResponse {
+	out := backend.DataResponse{
+		Error:  resp.Error,
+		Status: resp.Status,
+		Frames: make(data.Frames, len(resp.Frames)),
+	}
+	for i, frame := range resp.Frames {
+		f := *frame
+		if frame.Meta != nil {
+			meta := *frame.Meta
+			meta.Custom = copyCustomMeta(frame.Meta.Custom)
+			f.Meta = &meta
+		}
+		out.Frames[i] = &f
+	}
+	return out
+}
+
+func copyCustomMeta(custom any) any {
+	m, ok := custom.(map[string]any)
+	if !ok {
+		return custom
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// setCustomMeta sets key in the custom metadata of every frame in resp.
+func setCustomMeta(resp backend.DataResponse, key string, value any) {
+	for _, frame := range resp.Frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]any)
+		if !ok {
+			custom = map[string]any{}
+			frame.Meta.Custom = custom
+		}
+		custom[key] = value
+	}
+}
+
+// cachedQuery executes a query through the result cache of the datasource.
+// The cache status is reported in the custom metadata of the frames.
+func (d *FlightSQLDatasource) cachedQuery(ctx context.Context, query queryModel) backend.DataResponse {
+	if d.cache == nil {
+		return d.query(ctx, query)
+	}
+	if query.NoCache {
+		resp := d.query(ctx, query)
+		setCustomMeta(resp, "cache", cacheStatusBypass)
+		return resp
+	}
+
+	query, err := query.withTimeRange(d.cache.alignTimeRange(query.TimeRange))
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+	key, err := cacheKey(query)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("cache key: %s", err))
+	}
+	if resp, ok := d.cache.get(key); ok {
+		setCustomMeta(resp, "cache", cacheStatusHit)
+		return resp
+	}
+	resp := d.query(ctx, query)
+	d.cache.set(key, resp)
+	setCustomMeta(resp, "cache", cacheStatusMiss)
+	return resp
+}
@@ -0,0 +1,214 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCache(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	cache := newQueryCache(config{QueryCacheTTL: duration(time.Minute)})
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get("a")
+	require.False(t, ok)
+
+	cache.set("a", newCacheTestResponse(3))
+	resp, ok := cache.get("a")
+	require.True(t, ok)
+	require.Equal(t, 3, resp.Frames[0].Rows())
+
+	// Modifying the returned metadata must not affect the cached entry.
+	setCustomMeta(resp, "cache", cacheStatusHit)
+	resp, ok = cache.get("a")
+	require.True(t, ok)
+	require.Equal(t, map[string]any{}, resp.Frames[0].Meta.Custom)
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("a")
+	require.False(t, ok)
+	require.Equal(t, 0, cache.rows)
+}
+
+func TestQueryCache_Errors(t *testing.T) {
+	cache := newQueryCache(config{QueryCacheTTL: duration(time.Minute)})
+	cache.set("a", backend.ErrDataResponse(backend.StatusInternal, "boom"))
+	_, ok := cache.get("a")
+	require.False(t, ok)
+}
+
+func TestQueryCache_Eviction(t *testing.T) {
+	cache := newQueryCache(config{
+		QueryCacheTTL:        duration(time.Minute),
+		QueryCacheMaxEntries: 2,
+		QueryCacheMaxRows:    10,
+	})
+
+	cache.set("a", newCacheTestResponse(1))
+	cache.set("b", newCacheTestResponse(1))
+	_, ok := cache.get("a")
+	require.True(t, ok)
+
+	// "b" is the least recently used entry.
+	cache.set("c", newCacheTestResponse(1))
+	_, ok = cache.get("b")
+	require.False(t, ok)
+
+	// Exceeding the row bound evicts until the bound holds again.
+	cache.set("d", newCacheTestResponse(9))
+	_, ok = cache.get("a")
+	require.False(t, ok)
+	require.Equal(t, 2, cache.lru.Len())
+	require.Equal(t, 10, cache.rows)
+
+	// Responses larger than the row bound are never stored.
+	cache.set("e", newCacheTestResponse(11))
+	_, ok = cache.get("e")
+	require.False(t, ok)
+}
+
+func TestQueryCache_AlignTimeRange(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:12Z")
+	cache := newQueryCache(config{
+		QueryCacheTTL:         duration(time.Minute),
+		QueryCacheGranularity: duration(time.Minute),
+	})
+
+	tr := cache.alignTimeRange(backend.TimeRange{From: from, To: from.Add(time.Hour)})
+	require.Equal(t, "2023-01-01T00:00:00Z", tr.From.Format(time.RFC3339))
+	require.Equal(t, "2023-01-01T01:01:00Z", tr.To.Format(time.RFC3339))
+
+	// Aligned ranges are left untouched.
+	require.Equal(t, tr, cache.alignTimeRange(tr))
+}
+
+func TestCacheKey(t *testing.T) {
+	key := func(query queryModel) string {
+		k, err := cacheKey(query)
+		require.NoError(t, err)
+		return k
+	}
+
+	table := queryModel{Query: sqlutil.Query{RawSQL: "select 1", Format: sqlutil.FormatOptionTable, RefID: "A"}}
+	timeSeries := queryModel{Query: sqlutil.Query{RawSQL: "select 1", Format: sqlutil.FormatOptionTimeSeries, RefID: "A"}}
+	require.NotEqual(t, key(table), key(timeSeries))
+
+	// Queries formatted differently do not share results.
+	legendA, legendB := timeSeries, timeSeries
+	legendA.LegendFormat = "{{host}}"
+	legendB.LegendFormat = "{{host}} {{__field}}"
+	require.NotEqual(t, key(legendA), key(legendB))
+	require.NotEqual(t, key(timeSeries), key(legendA))
+
+	configured := timeSeries
+	configured.FieldConfig = map[string]fieldOptions{"value": {Unit: "bytes"}}
+	require.NotEqual(t, key(timeSeries), key(configured))
+
+	// The ref ID only matters to frame names referring to it.
+	other := timeSeries
+	other.RefID = "B"
+	require.Equal(t, key(timeSeries), key(other))
+	timeSeries.FrameName, other.FrameName = "{{__refId}}", "{{__refId}}"
+	require.NotEqual(t, key(timeSeries), key(other))
+
+	// Filled results depend on the time range.
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	filled := queryModel{Query: sqlutil.Query{RawSQL: "select 1", TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)}}}
+	filled.Fill = fillModeNull
+	moved := filled
+	moved.TimeRange.To = from.Add(2 * time.Hour)
+	require.NotEqual(t, key(filled), key(moved))
+}
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	cs := []struct {
+		in  string
+		out time.Duration
+	}{
+		{in: `"5m"`, out: 5 * time.Minute},
+		{in: `"30"`, out: 30 * time.Second},
+		{in: `30`, out: 30 * time.Second},
+		{in: `""`, out: 0},
+	}
+	for _, c := range cs {
+		t.Run(c.in, func(t *testing.T) {
+			var d duration
+			require.NoError(t, json.Unmarshal([]byte(c.in), &d))
+			require.Equal(t, c.out, time.Duration(d))
+		})
+	}
+
+	var d duration
+	require.Error(t, json.Unmarshal([]byte(`"soon"`), &d))
+}
+
+func newCacheTestResponse(rows int) backend.DataResponse {
+	values := make([]int64, rows)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	frame := data.NewFrame(fmt.Sprintf("rows-%d", rows), data.NewField("value", nil, values))
+	frame.Meta = &data.FrameMeta{Custom: map[string]any{}}
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+func TestIntegration_QueryData_Cache(t *testing.T) {
+	ds := newTestDatasource(t, config{
+		QueryCacheTTL:         duration(time.Minute),
+		QueryCacheGranularity: duration(time.Minute),
+	})
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from.Add(10 * time.Second), To: from.Add(time.Hour + 10*time.Second)}
+	query := queryRequest{
+		RefID:  "A",
+		Text:   "select id from intTable where $__timeFrom is not null",
+		Format: "table",
+	}
+
+	require.Equal(t, cacheStatusMiss, queryCacheStatus(t, ds, query, tr))
+	require.Equal(t, cacheStatusHit, queryCacheStatus(t, ds, query, tr))
+
+	// Relative time ranges that moved within the granularity expand to the
+	// same SQL.
+	shifted := backend.TimeRange{From: tr.From.Add(20 * time.Second), To: tr.To.Add(20 * time.Second)}
+	require.Equal(t, cacheStatusHit, queryCacheStatus(t, ds, query, shifted))
+
+	moved := backend.TimeRange{From: tr.From.Add(time.Minute), To: tr.To.Add(time.Minute)}
+	require.Equal(t, cacheStatusMiss, queryCacheStatus(t, ds, query, moved))
+
+	// Panels formatting the same SQL differently do not share results.
+	query.LegendFormat = "{{__field}}"
+	require.Equal(t, cacheStatusMiss, queryCacheStatus(t, ds, query, tr))
+	require.Equal(t, cacheStatusHit, queryCacheStatus(t, ds, query, tr))
+
+	query.NoCache = true
+	require.Equal(t, cacheStatusBypass, queryCacheStatus(t, ds, query, tr))
+}
+
+// queryCacheStatus executes the query through QueryData and returns the cache
+// status reported by its frame.
+func queryCacheStatus(t *testing.T, ds *FlightSQLDatasource, query queryRequest, tr backend.TimeRange) string {
+	t.Helper()
+
+	b, err := json.Marshal(query)
+	require.NoError(t, err)
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{{RefID: query.RefID, JSON: b, TimeRange: tr}},
+	})
+	require.NoError(t, err)
+
+	r := resp.Responses[query.RefID]
+	require.NoError(t, r.Error)
+	require.Len(t, r.Frames, 1)
+	require.Equal(t, 4, r.Frames[0].Rows())
+	return r.Frames[0].Meta.Custom.(map[string]any)["cache"].(string)
+}
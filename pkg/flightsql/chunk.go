@@ -0,0 +1,217 @@
+package flightsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// maxChunkConcurrency is the number of chunks of a query that are executed
+	// at the same time.
+	maxChunkConcurrency = 4
+	// maxChunks is the number of chunks a time range may be split into. It
+	// protects the server from chunk intervals that are too small for the time
+	// range.
+	maxChunks = 1000
+)
+
+// errTooManyChunks is returned for chunk intervals that split the time range
+// of a query into more than [maxChunks] chunks.
+var errTooManyChunks = errors.New("too many chunks")
+
+// queryResults executes the query and reads its results into a single frame.
+// Queries with a chunk interval are executed once per chunk of their time
+// range.
+func (d *FlightSQLDatasource) queryResults(ctx context.Context, query queryModel) (*data.Frame, metadata.MD, error) {
+	if query.ChunkInterval <= 0 {
+		return d.queryFrame(ctx, query.RawSQL)
+	}
+	interval := chunkInterval(query.ChunkInterval, query.Interval)
+	chunks := chunkTimeRange(query.TimeRange, interval)
+	if len(chunks) > maxChunks {
+		return nil, nil, fmt.Errorf("%w: chunk interval %s splits the time range into more than %d chunks", errTooManyChunks, interval, maxChunks)
+	}
+	if len(chunks) <= 1 {
+		return d.queryFrame(ctx, query.RawSQL)
+	}
+	return d.queryChunks(ctx, query, chunks)
+}
+
+// chunkResult is the result of executing a single chunk of a query.
+type chunkResult struct {
+	frame   *data.Frame
+	headers metadata.MD
+}
+
+// queryChunks executes the query once per chunk with its macros expanded for
+// the time range of the chunk and concatenates the results in time order.
+func (d *FlightSQLDatasource) queryChunks(ctx context.Context, query queryModel, chunks []backend.TimeRange) (*data.Frame, metadata.MD, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, maxChunkConcurrency)
+		results  = make([]chunkResult, len(chunks))
+		mu       sync.Mutex
+		firstErr error
+	)
+	// fail records the first error and cancels the remaining chunks. Errors
+	// of chunks that fail due to the cancellation are not reported.
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = fmt.Errorf("chunk %d: %w", i, err)
+		}
+		cancel()
+	}
+
+	sqls := make([]string, len(chunks))
+	for i, tr := range chunks {
+		chunk, err := query.withTimeRange(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		sqls[i] = chunk.RawSQL
+	}
+
+	for i, sql := range sqls {
+		wg.Add(1)
+		go func(i int, sql string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				fail(i, ctx.Err())
+				return
+			}
+			defer func() { <-sem }()
+
+			frame, headers, err := d.queryFrame(ctx, sql)
+			if err != nil {
+				fail(i, err)
+				return
+			}
+			results[i] = chunkResult{frame: frame, headers: headers}
+		}(i, sql)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+
+	frame, err := concatChunks(results, chunks, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return frame, results[0].headers, nil
+}
+
+// concatChunks concatenates the results of the chunks of a query in time
+// order. The notices of the chunk frames are kept.
+func concatChunks(results []chunkResult, chunks []backend.TimeRange, query queryModel) (*data.Frame, error) {
+	frame := results[0].frame.EmptyCopy()
+	frame.Meta = &data.FrameMeta{}
+	for i, r := range results {
+		if err := checkSameFields(frame, r.frame); err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		appendRows(frame, r.frame, chunkRows(r.frame, query, chunks[i], i == len(chunks)-1))
+		if r.frame.Meta != nil {
+			appendNewNotices(frame, r.frame.Meta.Notices)
+		}
+		if frame.Rows() > rowLimit {
+			appendNewNotices(frame, []data.Notice{{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("Results have been limited to %v because the SQL row limit was reached", rowLimit),
+			}})
+			break
+		}
+	}
+	return frame, nil
+}
+
+// appendNewNotices appends the notices the frame does not have yet.
+func appendNewNotices(frame *data.Frame, notices []data.Notice) {
+	for _, n := range notices {
+		seen := false
+		for _, m := range frame.Meta.Notices {
+			if m == n {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			frame.AppendNotices(n)
+		}
+	}
+}
+
+// chunkRows returns a function for [appendRows] that drops rows at the end of
+// the time range of a chunk. The time macros include both ends of the time
+// range so these rows are also returned by the next chunk. Frames without a
+// time column are kept whole.
+func chunkRows(frame *data.Frame, query queryModel, tr backend.TimeRange, last bool) func(int) bool {
+	times := queryTimeField(frame, query)
+	if times == nil || last {
+		return nil
+	}
+	return keepTimes(times, func(t time.Time) bool {
+		return t.Before(tr.To)
+	})
+}
+
+// chunkInterval returns the chunk interval rounded up to a multiple of the
+// interval of the query. Time buckets such as those of $__dateBin are aligned
+// to multiples of the interval of the query, so chunk boundaries then fall on
+// bucket boundaries and no bucket is split across chunks.
+func chunkInterval(chunk, interval time.Duration) time.Duration {
+	if interval <= 0 || chunk%interval == 0 {
+		return chunk
+	}
+	return (chunk/interval + 1) * interval
+}
+
+// chunkTimeRange splits tr into consecutive time ranges whose boundaries are
+// aligned to multiples of interval since the Unix epoch, the origin of time
+// buckets. Intervals should be given by
+// [chunkInterval] so that time buckets are not split across chunks.
+func chunkTimeRange(tr backend.TimeRange, interval time.Duration) []backend.TimeRange {
+	if interval <= 0 || !tr.To.After(tr.From) {
+		return []backend.TimeRange{tr}
+	}
+	var (
+		chunks []backend.TimeRange
+		from   = tr.From
+	)
+	for from.Before(tr.To) {
+		to := time.Unix(0, from.UnixNano()-floorMod(from.UnixNano(), int64(interval))).Add(interval).In(from.Location())
+		if to.After(tr.To) {
+			to = tr.To
+		}
+		chunks = append(chunks, backend.TimeRange{From: from, To: to})
+		if len(chunks) > maxChunks {
+			break
+		}
+		from = to
+	}
+	return chunks
+}
+
+// floorMod returns the remainder of a divided by b with the sign of b.
+func floorMod(a, b int64) int64 {
+	m := a % b
+	if m != 0 && (m < 0) != (b < 0) {
+		m += b
+	}
+	return m
+}
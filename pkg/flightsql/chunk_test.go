@@ -0,0 +1,110 @@
+package flightsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkTimeRange(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T10:30:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(2 * 24 * time.Hour)}
+
+	chunks := chunkTimeRange(tr, 24*time.Hour)
+	require.Len(t, chunks, 3)
+
+	// Boundaries are aligned to the chunk interval.
+	require.Equal(t, from, chunks[0].From)
+	require.Equal(t, "2023-01-02T00:00:00Z", chunks[0].To.Format(time.RFC3339))
+	require.Equal(t, chunks[0].To, chunks[1].From)
+	require.Equal(t, "2023-01-03T00:00:00Z", chunks[1].To.Format(time.RFC3339))
+	require.Equal(t, chunks[1].To, chunks[2].From)
+	require.Equal(t, tr.To, chunks[2].To)
+
+	require.Equal(t, []backend.TimeRange{tr}, chunkTimeRange(tr, 0))
+	require.Len(t, chunkTimeRange(tr, time.Second), maxChunks+1)
+}
+
+func TestChunkInterval(t *testing.T) {
+	require.Equal(t, time.Hour, chunkInterval(time.Hour, 0))
+	require.Equal(t, time.Hour, chunkInterval(time.Hour, time.Minute))
+	require.Equal(t, 63*time.Minute, chunkInterval(time.Hour, 7*time.Minute))
+	require.Equal(t, 2*time.Hour, chunkInterval(30*time.Minute, 2*time.Hour))
+
+	// Chunk boundaries fall on the boundaries of the buckets of the query.
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T10:30:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+	for _, chunk := range chunkTimeRange(tr, chunkInterval(time.Hour, 7*time.Minute))[1:] {
+		require.Zero(t, chunk.From.UnixNano()%int64(7*time.Minute))
+	}
+}
+
+func TestChunkRows(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Minute)}
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{from, from.Add(time.Second), tr.To}),
+		data.NewField("value", nil, []int64{1, 2, 3}),
+	)
+
+	// Rows at the end of a chunk are left to the next chunk.
+	out := frame.EmptyCopy()
+	appendRows(out, frame, chunkRows(frame, queryModel{}, tr, false))
+	require.Equal(t, []int64{1, 2}, extractFieldValues[int64](t, out.Fields[1]))
+
+	out = frame.EmptyCopy()
+	appendRows(out, frame, chunkRows(frame, queryModel{}, tr, true))
+	require.Equal(t, []int64{1, 2, 3}, extractFieldValues[int64](t, out.Fields[1]))
+
+	// Frames without a time column are kept whole.
+	noTime := data.NewFrame("", data.NewField("value", nil, []int64{1, 2, 3}))
+	require.Nil(t, chunkRows(noTime, queryModel{}, tr, false))
+}
+
+func TestConcatChunks(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	chunks := []backend.TimeRange{
+		{From: from, To: from.Add(time.Minute)},
+		{From: from.Add(time.Minute), To: from.Add(2 * time.Minute)},
+	}
+	notice := data.Notice{Severity: data.NoticeSeverityWarning, Text: "limited"}
+	newChunk := func(times ...time.Time) chunkResult {
+		frame := data.NewFrame("",
+			data.NewField("time", nil, times),
+			data.NewField("value", nil, make([]int64, len(times))),
+		)
+		frame.AppendNotices(notice)
+		return chunkResult{frame: frame}
+	}
+
+	frame, err := concatChunks([]chunkResult{
+		newChunk(from, chunks[0].To),
+		newChunk(chunks[1].From, chunks[1].To),
+	}, chunks, queryModel{})
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{from, chunks[1].From, chunks[1].To}, extractFieldValues[time.Time](t, frame.Fields[0]))
+
+	// Notices of the chunks are kept once.
+	require.Equal(t, []data.Notice{notice}, frame.Meta.Notices)
+}
+
+func TestIntegration_QueryChunks_Canceled(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	query := queryModel{Text: "select id from intTable", ChunkInterval: time.Minute}
+	query.TimeRange = backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	query, err := query.interpolate()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Chunks that are canceled before they start report the cancellation.
+	_, _, err = ds.queryChunks(ctx, query, chunkTimeRange(query.TimeRange, query.ChunkInterval))
+	require.ErrorContains(t, err, "canceled")
+}
@@ -0,0 +1,74 @@
+package flightsql
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// frameTypeVersions maps the types of the data plane contract that frames are
+// tagged with to the version of the contract they follow. Types missing from
+// the map have version 0.0.
+var frameTypeVersions = map[data.FrameType]data.FrameTypeVersion{
+	data.FrameTypeTimeSeriesWide:  {0, 1},
+	data.FrameTypeTimeSeriesMulti: {0, 1},
+	data.FrameTypeNumericLong:     {0, 1},
+}
+
+// setFrameType tags a formatted frame with its type in the data plane
+// contract so that consumers such as alerting can read it without guessing
+// its shape. Formats that convert the results set the type of their frames
+// themselves. Time series that were already wide are tagged as wide and
+// tables that are [isNumericLong] as numeric long. Other frames are left
+// untyped.
+func setFrameType(frame *data.Frame, query queryModel) {
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	if frame.Meta.Type == data.FrameTypeUnknown {
+		switch {
+		case query.Format == sqlutil.FormatOptionTimeSeries && frame.TimeSeriesSchema().Type == data.TimeSeriesTypeWide:
+			frame.Meta.Type = data.FrameTypeTimeSeriesWide
+		case query.Format == sqlutil.FormatOptionTable && isNumericLong(frame):
+			frame.Meta.Type = data.FrameTypeNumericLong
+		}
+	}
+	frame.Meta.TypeVersion = frameTypeVersions[frame.Meta.Type]
+}
+
+// isNumericLong reports whether a table holds numeric values identified by
+// labels, as in `select host, count(*) from t group by host`: it has no time
+// fields, one numeric field and otherwise only string fields, and no two rows
+// have the same labels.
+func isNumericLong(frame *data.Frame) bool {
+	var numeric int
+	var labels []*data.Field
+	for _, field := range frame.Fields {
+		switch {
+		case field.Type().Numeric():
+			numeric++
+		case isStringField(field):
+			labels = append(labels, field)
+		default:
+			return false
+		}
+	}
+	if numeric != 1 {
+		return false
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < frame.Rows(); i++ {
+		values := make([]string, len(labels))
+		for j, field := range labels {
+			values[j] = labelAt(field, i)
+		}
+		key := strings.Join(values, "\x00")
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package flightsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNumericLong(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	require.True(t, isNumericLong(data.NewFrame("",
+		data.NewField("host", nil, []string{"a", "b"}),
+		data.NewField("region", nil, []*string{nil, ptr("eu")}),
+		data.NewField("count", nil, []*int64{ptr[int64](1), nil}),
+	)))
+	require.True(t, isNumericLong(data.NewFrame("",
+		data.NewField("count", nil, []int64{1}),
+	)))
+
+	// Rows with the same labels.
+	require.False(t, isNumericLong(data.NewFrame("",
+		data.NewField("host", nil, []string{"a", "a"}),
+		data.NewField("count", nil, []int64{1, 2}),
+	)))
+	// More than one value.
+	require.False(t, isNumericLong(data.NewFrame("",
+		data.NewField("host", nil, []string{"a"}),
+		data.NewField("count", nil, []int64{1}),
+		data.NewField("avg", nil, []float64{1}),
+	)))
+	// Other types of columns.
+	require.False(t, isNumericLong(data.NewFrame("",
+		data.NewField("time", nil, []time.Time{ts}),
+		data.NewField("count", nil, []int64{1}),
+	)))
+	require.False(t, isNumericLong(data.NewFrame("",
+		data.NewField("ok", nil, []bool{true}),
+		data.NewField("count", nil, []int64{1}),
+	)))
+}
+
+// requireDataplane asserts that a frame is tagged with a type of the data
+// plane contract and has the shape required by that type.
+func requireDataplane(t *testing.T, frame *data.Frame, typ data.FrameType) {
+	t.Helper()
+	require.Equal(t, typ, frame.Meta.Type)
+
+	switch typ {
+	case data.FrameTypeTimeSeriesWide, data.FrameTypeTimeSeriesMulti:
+		require.Equal(t, data.FrameTypeVersion{0, 1}, frame.Meta.TypeVersion)
+		require.Equal(t, data.TimeSeriesTypeWide, frame.TimeSeriesSchema().Type)
+		require.True(t, isTimeField(frame.Fields[0]))
+		times := extractFieldValues[time.Time](t, frame.Fields[0])
+		for i := 1; i < len(times); i++ {
+			require.True(t, times[i].After(times[i-1]), "times must be ascending and unique")
+		}
+		if typ == data.FrameTypeTimeSeriesMulti {
+			require.Len(t, frame.Fields, 2)
+		}
+		for _, field := range frame.Fields[1:] {
+			require.True(t, field.Type().Numeric(), "field %s must be numeric", field.Name)
+		}
+	case data.FrameTypeNumericLong:
+		require.Equal(t, data.FrameTypeVersion{0, 1}, frame.Meta.TypeVersion)
+		require.True(t, isNumericLong(frame))
+	case data.FrameTypeLogLines:
+		require.True(t, frame.Meta.TypeVersion.IsZero())
+		require.True(t, isTimeField(frame.Fields[0]))
+		require.True(t, isStringField(frame.Fields[1]))
+	default:
+		t.Fatalf("unexpected frame type %q", typ)
+	}
+}
+
+func TestFrameDataResponse_Dataplane(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	long := func() *data.Frame {
+		return data.NewFrame("",
+			data.NewField("time", nil, []time.Time{at(1), at(0), at(0), at(1)}),
+			data.NewField("host", nil, []string{"a", "a", "b", "b"}),
+			data.NewField("value", nil, []float64{1, 2, 3, 4}),
+		)
+	}
+	for _, tc := range []struct {
+		name   string
+		frame  *data.Frame
+		query  queryModel
+		frames int
+		typ    data.FrameType
+	}{
+		{
+			name:   "time series long",
+			frame:  long(),
+			query:  queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTimeSeries}},
+			frames: 1,
+			typ:    data.FrameTypeTimeSeriesWide,
+		},
+		{
+			name: "time series wide",
+			frame: data.NewFrame("",
+				data.NewField("time", nil, []time.Time{at(0), at(1)}),
+				data.NewField("value", nil, []int64{1, 2}),
+			),
+			query:  queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTimeSeries}},
+			frames: 1,
+			typ:    data.FrameTypeTimeSeriesWide,
+		},
+		{
+			name:   "time series multi",
+			frame:  long(),
+			query:  queryModel{Query: sqlutil.Query{Format: formatOptionTimeSeriesMulti}},
+			frames: 2,
+			typ:    data.FrameTypeTimeSeriesMulti,
+		},
+		{
+			name: "numeric table",
+			frame: data.NewFrame("",
+				data.NewField("host", nil, []string{"a", "b"}),
+				data.NewField("count", nil, []int64{1, 2}),
+			),
+			query:  queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTable}},
+			frames: 1,
+			typ:    data.FrameTypeNumericLong,
+		},
+		{
+			name: "logs",
+			frame: data.NewFrame("",
+				data.NewField("time", nil, []time.Time{at(0)}),
+				data.NewField("message", nil, []string{"started"}),
+			),
+			query:  queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionLogs}},
+			frames: 1,
+			typ:    data.FrameTypeLogLines,
+		},
+		{
+			name: "logs volume",
+			frame: data.NewFrame("",
+				data.NewField("time", nil, []time.Time{at(0), at(1)}),
+				data.NewField("count", nil, []int64{1, 1}),
+			),
+			query: queryModel{
+				Query:      sqlutil.Query{Format: sqlutil.FormatOptionLogs, Interval: time.Second},
+				QueryType:  queryTypeLogsVolume,
+				TimeColumn: "time",
+			},
+			frames: 1,
+			typ:    data.FrameTypeTimeSeriesWide,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.frame.Meta = &data.FrameMeta{}
+			resp := frameDataResponse(tc.frame, nil, tc.query, nil)
+			require.NoError(t, resp.Error)
+			require.Len(t, resp.Frames, tc.frames)
+			for _, frame := range resp.Frames {
+				requireDataplane(t, frame, tc.typ)
+			}
+		})
+	}
+
+	t.Run("table", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("host", nil, []string{"a", "b"}),
+			data.NewField("count", nil, []int64{1, 2}),
+			data.NewField("avg", nil, []float64{1, 2}),
+		)
+		frame.Meta = &data.FrameMeta{}
+		resp := frameDataResponse(frame, nil, queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTable}}, nil)
+		require.NoError(t, resp.Error)
+		require.Equal(t, data.FrameTypeUnknown, resp.Frames[0].Meta.Type)
+		require.True(t, resp.Frames[0].Meta.TypeVersion.IsZero())
+	})
+}
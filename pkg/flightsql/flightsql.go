@@ -31,6 +31,32 @@ type config struct {
 	Username string              `json:"username"`
 	Password string              `json:"password"`
 	Token    string              `json:"token"`
+
+	// QueryCacheTTL enables caching of query results for the given duration.
+	QueryCacheTTL duration `json:"queryCacheTTL"`
+	// QueryCacheGranularity rounds query time ranges to the given duration
+	// before macro expansion so that relative time ranges hit the cache.
+	QueryCacheGranularity duration `json:"queryCacheGranularity"`
+	QueryCacheMaxEntries  int      `json:"queryCacheMaxEntries"`
+	QueryCacheMaxRows     int      `json:"queryCacheMaxRows"`
+	// MetadataCacheTTL is how long metadata such as tables and columns is
+	// cached. It defaults to a minute.
+	MetadataCacheTTL duration `json:"metadataCacheTTL"`
+
+	// TableTypes are the types of the tables listed when browsing metadata.
+	// It defaults to [defaultTableTypes]. Tables of every type, including
+	// views and system tables, are listed if it is ["*"].
+	TableTypes []string `json:"tableTypes"`
+	// DefaultCatalog and DefaultSchema limit metadata browsing to a catalog
+	// and schema unless a request names another one.
+	DefaultCatalog string `json:"defaultCatalog"`
+	DefaultSchema  string `json:"defaultSchema"`
+	// SessionCatalogKey and SessionSchemaKey name the gRPC metadata keys the
+	// server reads the default catalog and schema of queries from, if it
+	// supports any. The default catalog and schema are sent under these keys
+	// unless the metadata already sets them.
+	SessionCatalogKey string `json:"sessionCatalogKey"`
+	SessionSchemaKey  string `json:"sessionSchemaKey"`
 }
 
 func (cfg config) validate() error {
@@ -46,6 +72,13 @@ func (cfg config) validate() error {
 		return fmt.Errorf("token or username/password are required")
 	}
 
+	if cfg.QueryCacheTTL < 0 || cfg.QueryCacheGranularity < 0 {
+		return fmt.Errorf("query cache durations must not be negative")
+	}
+	if cfg.MetadataCacheTTL < 0 {
+		return fmt.Errorf("metadata cache TTL must not be negative")
+	}
+
 	return nil
 }
 
@@ -54,6 +87,14 @@ type FlightSQLDatasource struct {
 	client          *client
 	resourceHandler backend.CallResourceHandler
 	md              metadata.MD
+	cache           *queryCache
+	incremental     *lruCache[incrementalEntry]
+	tags            *lruCache[[]string]
+	metadata        *metadataCache
+
+	tableTypes     []string
+	defaultCatalog string
+	defaultSchema  string
 }
 
 // NewDatasource creates a new datasource instance.
@@ -107,25 +148,76 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 		md.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.Token))
 	}
 
+	setSessionDefault(md, cfg.SessionCatalogKey, cfg.DefaultCatalog)
+	setSessionDefault(md, cfg.SessionSchemaKey, cfg.DefaultSchema)
+
 	ds := &FlightSQLDatasource{
-		client: client,
-		md:     md,
+		client:      client,
+		md:          md,
+		cache:       newQueryCache(cfg),
+		incremental: newIncrementalCache(),
+		tags:        newTagCache(),
+		metadata:    newMetadataCache(cfg),
+
+		tableTypes:     tableTypes(cfg.TableTypes),
+		defaultCatalog: cfg.DefaultCatalog,
+		defaultSchema:  cfg.DefaultSchema,
 	}
 	r := chi.NewRouter()
 	r.Use(recoverer)
 	r.Route("/plugin", func(r chi.Router) {
 		r.Get("/macros", ds.getMacros)
+		r.Post("/interpolate", ds.postInterpolate)
 	})
 	r.Route("/flightsql", func(r chi.Router) {
 		r.Get("/sql-info", ds.getSQLInfo)
+		r.Get("/catalogs", ds.getCatalogs)
+		r.Get("/schemas", ds.getSchemas)
+		r.Get("/table-types", ds.getTableTypes)
 		r.Get("/tables", ds.getTables)
 		r.Get("/columns", ds.getColumns)
+		r.Get("/primary-keys", ds.getPrimaryKeys)
+		r.Get("/exported-keys", ds.getExportedKeys)
+		r.Get("/imported-keys", ds.getImportedKeys)
+		r.Get("/cross-reference", ds.getCrossReference)
+		r.Get("/tag-keys", ds.getTagKeys)
+		r.Get("/tag-values", ds.getTagValues)
+		r.Post("/validate", ds.postValidate)
+		r.Post("/cache/flush", ds.flushCache)
 	})
 	ds.resourceHandler = httpadapter.New(r)
 
 	return ds, nil
 }
 
+// defaultTableTypes are the types of the tables listed when browsing
+// metadata if the datasource does not configure them.
+var defaultTableTypes = []string{"BASE TABLE", "table"}
+
+// tableTypes returns the table types to filter tables by for the configured
+// table types. Tables are not filtered by type if the configuration asks for
+// every type.
+func tableTypes(configured []string) []string {
+	if len(configured) == 0 {
+		return defaultTableTypes
+	}
+	for _, t := range configured {
+		if t == "*" {
+			return nil
+		}
+	}
+	return configured
+}
+
+// setSessionDefault sets key to value in md unless either is empty or md
+// already sets key.
+func setSessionDefault(md metadata.MD, key, value string) {
+	if key == "" || value == "" || len(md.Get(key)) != 0 {
+		return
+	}
+	md.Set(key, value)
+}
+
 // Dispose cleans up before we are reaped.
 func (d *FlightSQLDatasource) Dispose() {
 	if err := d.client.Close(); err != nil {
@@ -144,9 +236,11 @@ func (d *FlightSQLDatasource) CallResource(ctx context.Context, req *backend.Cal
 // datasource configuration page which allows users to verify that
 // a datasource is working as expected.
 func (d *FlightSQLDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	query := sqlutil.Query{
-		RawSQL: "select 1",
-		Format: sqlutil.FormatOptionTable,
+	query := queryModel{
+		Query: sqlutil.Query{
+			RawSQL: "select 1",
+			Format: sqlutil.FormatOptionTable,
+		},
 	}
 	if resp := d.query(ctx, query); resp.Error != nil {
 		return &backend.CheckHealthResult{
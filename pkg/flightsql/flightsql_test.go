@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/apache/arrow/go/v12/arrow/flight"
 	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
@@ -71,6 +72,105 @@ func TestIntegration_QueryData(t *testing.T) {
 	}
 }
 
+func TestIntegration_QueryData_Chunked(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	b, err := json.Marshal(queryRequest{
+		RefID:                     "A",
+		Text:                      "select id from intTable where $__timeFrom is not null",
+		Format:                    "table",
+		ChunkIntervalMilliseconds: time.Hour.Milliseconds(),
+	})
+	require.NoError(t, err)
+
+	resp, err := ds.QueryData(context.Background(),
+		&backend.QueryDataRequest{
+			Queries: []backend.DataQuery{
+				{
+					RefID:     "A",
+					JSON:      b,
+					TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Hour)},
+				},
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	respA := resp.Responses["A"]
+	require.NoError(t, respA.Error)
+	require.Len(t, respA.Frames, 1)
+
+	// Each of the three chunks returns every row of the table.
+	require.Equal(t, 12, respA.Frames[0].Rows())
+}
+
+func TestIntegration_QueryData_TooManyChunks(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	b, err := json.Marshal(queryRequest{
+		RefID:                     "A",
+		Text:                      "select id from intTable",
+		Format:                    "table",
+		ChunkIntervalMilliseconds: time.Second.Milliseconds(),
+	})
+	require.NoError(t, err)
+
+	resp, err := ds.QueryData(context.Background(),
+		&backend.QueryDataRequest{
+			Queries: []backend.DataQuery{
+				{
+					RefID:     "A",
+					JSON:      b,
+					TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+				},
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	respA := resp.Responses["A"]
+	require.ErrorContains(t, respA.Error, errTooManyChunks.Error())
+	require.Equal(t, backend.StatusBadRequest, respA.Status)
+}
+
+// newTestDatasource returns a datasource connected to an example SQLite Flight
+// SQL server that is shut down at the end of the test. The setup statements
+// are executed against the database before the server starts.
+func newTestDatasource(t *testing.T, cfg config, setup ...string) *FlightSQLDatasource {
+	t.Helper()
+
+	db, err := example.CreateDB()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range setup {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	sqliteServer, err := example.NewSQLiteFlightSQLServer(db)
+	require.NoError(t, err)
+	sqliteServer.Alloc = memory.NewCheckedAllocator(memory.DefaultAllocator)
+	server := flight.NewServerWithMiddleware(nil)
+	server.RegisterFlightService(flightsql.NewFlightServer(sqliteServer))
+	err = server.Init("localhost:0")
+	require.NoError(t, err)
+	go server.Serve()
+	t.Cleanup(server.Shutdown)
+
+	cfg.Addr = server.Addr().String()
+	cfg.Token = "secret"
+	cfgJSON, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	settings := backend.DataSourceInstanceSettings{JSONData: cfgJSON}
+	ds, err := NewDatasource(context.Background(), settings)
+	require.NoError(t, err)
+	t.Cleanup(ds.(*FlightSQLDatasource).Dispose)
+	return ds.(*FlightSQLDatasource)
+}
+
 func mustQueryJSON(t *testing.T, refID, sql string) []byte {
 	t.Helper()
 
@@ -0,0 +1,144 @@
+package flightsql
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// checkSameFields returns an error unless both frames have fields with the
+// same names and types.
+func checkSameFields(a, b *data.Frame) error {
+	if len(a.Fields) != len(b.Fields) {
+		return fmt.Errorf("column count changed from %d to %d", len(a.Fields), len(b.Fields))
+	}
+	for i, f := range a.Fields {
+		if f.Name != b.Fields[i].Name || f.Type() != b.Fields[i].Type() {
+			return fmt.Errorf("column %d changed from %s (%s) to %s (%s)", i, f.Name, f.Type(), b.Fields[i].Name, b.Fields[i].Type())
+		}
+	}
+	return nil
+}
+
+// emptyCopy returns a copy of the frame without rows. Unlike
+// [data.Frame.EmptyCopy] it keeps the metadata of the frame and the config of
+// its fields.
+func emptyCopy(frame *data.Frame) *data.Frame {
+	out := frame.EmptyCopy()
+	out.Meta = frame.Meta
+	for i, f := range frame.Fields {
+		out.Fields[i].Config = f.Config
+	}
+	return out
+}
+
+// copyFrame returns a copy of the rows of the frame whose fields can be
+// modified without affecting the frame. The metadata of the frame is not
+// copied.
+func copyFrame(frame *data.Frame) *data.Frame {
+	out := frame.EmptyCopy()
+	appendRows(out, frame, nil)
+	return out
+}
+
+// appendRow appends row i of src to dst. Both frames must have the same
+// fields.
+func appendRow(dst, src *data.Frame, i int) {
+	for j, f := range src.Fields {
+		dst.Fields[j].Append(f.At(i))
+	}
+}
+
+// appendRows appends the rows of src for which keep returns true to dst. Both
+// frames must have the same fields.
+func appendRows(dst, src *data.Frame, keep func(row int) bool) {
+	for i := 0; i < src.Rows(); i++ {
+		if keep != nil && !keep(i) {
+			continue
+		}
+		appendRow(dst, src, i)
+	}
+}
+
+// keepTimes returns a function for [appendRows] that keeps the rows of the
+// frame whose value in the time field satisfies keep. Rows without a time are
+// dropped.
+func keepTimes(times *data.Field, keep func(time.Time) bool) func(int) bool {
+	return func(row int) bool {
+		v, ok := times.ConcreteAt(row)
+		return ok && keep(v.(time.Time))
+	}
+}
+
+// fieldOptions are display options for the fields of a column, mapped onto
+// their [data.FieldConfig].
+type fieldOptions struct {
+	Unit        string  `json:"unit"`
+	Decimals    *uint16 `json:"decimals"`
+	DisplayName string  `json:"displayName"`
+}
+
+// templateVariable matches the `{{name}}` placeholders of frame name and
+// legend templates.
+var templateVariable = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// renderTemplate replaces the placeholders in tmpl with their values in vars.
+// Placeholders without a value are replaced with an empty string.
+func renderTemplate(tmpl string, vars map[string]string) string {
+	return templateVariable.ReplaceAllStringFunc(tmpl, func(s string) string {
+		return vars[templateVariable.FindStringSubmatch(s)[1]]
+	})
+}
+
+// applyFrameOptions names the frame and configures the display of its fields
+// according to the options of the query.
+//
+// Legend templates may refer to the labels of a field and to the name of the
+// field as `{{__field}}`. Frame name templates may refer to the ref ID of the
+// query as `{{__refId}}`.
+func applyFrameOptions(frame *data.Frame, query queryModel) {
+	if query.FrameName != "" {
+		frame.Name = renderTemplate(query.FrameName, map[string]string{
+			"__refId": query.RefID,
+		})
+	}
+
+	for _, field := range frame.Fields {
+		if query.LegendFormat != "" && !isTimeField(field) {
+			vars := map[string]string{"__field": field.Name}
+			for k, v := range field.Labels {
+				vars[k] = v
+			}
+			fieldConfig(field).DisplayNameFromDS = renderTemplate(query.LegendFormat, vars)
+		}
+
+		opts, ok := query.FieldConfig[field.Name]
+		if !ok {
+			continue
+		}
+		cfg := fieldConfig(field)
+		if opts.Unit != "" {
+			cfg.Unit = opts.Unit
+		}
+		if opts.Decimals != nil {
+			cfg.Decimals = opts.Decimals
+		}
+		if opts.DisplayName != "" {
+			cfg.DisplayNameFromDS = opts.DisplayName
+		}
+	}
+}
+
+// fieldConfig returns the config of the field, creating it if necessary.
+func fieldConfig(field *data.Field) *data.FieldConfig {
+	if field.Config == nil {
+		field.Config = &data.FieldConfig{}
+	}
+	return field.Config
+}
+
+func isTimeField(field *data.Field) bool {
+	return field.Type().Time()
+}
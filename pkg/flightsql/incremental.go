@@ -0,0 +1,205 @@
+package flightsql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+const (
+	// incrementalMaxAge is how long the results of a full query are extended
+	// incrementally before the whole time range is queried again. This bounds
+	// how long corrections to older data go unnoticed.
+	incrementalMaxAge = 10 * time.Minute
+	// incrementalOverlap is the minimum duration before the end of the previous
+	// time range that is queried again on refresh to pick up late data.
+	incrementalOverlap = time.Minute
+)
+
+var (
+	// incrementalFromMacro matches the macros that bound the start of the time
+	// range of a query. Only queries using one of them can be limited to the
+	// tail of the time range.
+	incrementalFromMacro = regexp.MustCompile(`\$__(timeFrom|timeRange|timeFilter|timeRangeFrom)\b`)
+	// incrementalTimeFrom matches the uses of $__timeFrom along with the
+	// comparison operators around them.
+	incrementalTimeFrom = regexp.MustCompile(`(?i)(?:([<>]=?|=|\bbetween)\s*)?\$__timeFrom\b(\s*(?:[<>]=?|=))?`)
+	// incrementalUnsupported matches SQL constructs whose results over a
+	// partial time range cannot be merged with previous results.
+	incrementalUnsupported = regexp.MustCompile(`(?i)\b(limit|offset|over|union)\b`)
+)
+
+// incrementalEntry holds the unformatted results of the previous execution of
+// an incremental query.
+type incrementalEntry struct {
+	frame     *data.Frame
+	timeRange backend.TimeRange
+	created   time.Time
+}
+
+func newIncrementalCache() *lruCache[incrementalEntry] {
+	return newLRUCache(incrementalMaxAge, 0, 0, func(e incrementalEntry) int {
+		return e.frame.Rows()
+	})
+}
+
+// incrementalKey identifies the results of an incremental query across
+// refreshes of its time range. Besides the text of the query, the key holds
+// the options changing its results: the predicate its ad-hoc filters expand
+// to, which depends on the identifier quote, and how its time column is read.
+func incrementalKey(query queryModel) string {
+	var filters string
+	if adhocFiltersMacro.MatchString(query.Text) {
+		// Invalid filters fail the query before it is stored.
+		filters, _ = adhocFiltersSQL(query.AdhocFilters, query.IdentifierQuote)
+	}
+	return fmt.Sprintf("%d:%s:%q:%s:%q:%s", query.Format, query.Interval, query.TimeColumn, query.TimeUnit, filters, query.Text)
+}
+
+// supportsIncremental reports whether the shape of the query allows its
+// results to be extended by querying only the tail of its time range.
+//
+// The tail is queried with the start of the time range moved forward, so
+// $__timeFrom may only be compared with. Other uses, such as the origin of
+// date_bin, would shift the results of the tail.
+func supportsIncremental(query queryModel) bool {
+	return (query.Format == sqlutil.FormatOptionTimeSeries || query.Format == formatOptionTimeSeriesMulti) &&
+		incrementalFromMacro.MatchString(query.Text) &&
+		!incrementalUnsupported.MatchString(query.Text) &&
+		timeFromFilters(query.Text) &&
+		len(splitStatements(query.Text)) == 1
+}
+
+// timeFromFilters reports whether every use of $__timeFrom in text is an
+// operand of a comparison.
+func timeFromFilters(text string) bool {
+	for _, m := range incrementalTimeFrom.FindAllStringSubmatch(text, -1) {
+		if m[1] == "" && m[2] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// incrementalQuery executes a time series query incrementally. The results of
+// the previous execution are kept and, when the time range moves forward, only
+// its new tail is queried and merged with them. Queries whose shape does not
+// allow this are executed in full.
+func (d *FlightSQLDatasource) incrementalQuery(ctx context.Context, query queryModel) (resp backend.DataResponse) {
+	defer recoverDataResponse(&resp)
+
+	if !supportsIncremental(query) {
+		return d.query(ctx, query)
+	}
+
+	key := incrementalKey(query)
+	prev, ok := d.incremental.get(key)
+	if ok && !prev.extends(query.TimeRange, query.Interval, d.incremental.now()) {
+		ok = false
+	}
+
+	tail := query
+	if ok {
+		var err error
+		tail, err = query.withTimeRange(backend.TimeRange{
+			From: prev.tailFrom(query.Interval),
+			To:   query.TimeRange.To,
+		})
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+	}
+
+	frame, headers, err := d.queryResults(ctx, tail)
+	if frame == nil {
+		return backend.ErrDataResponse(errorStatus(err), err.Error())
+	}
+	// Results are formatted for the whole time range of the query while the
+	// executed SQL is the one of the tail.
+	format := query
+	format.RawSQL = tail.RawSQL
+	if err != nil {
+		d.incremental.delete(key)
+		return frameDataResponse(frame, err, format, headers)
+	}
+
+	entry := incrementalEntry{
+		frame:     frame,
+		timeRange: query.TimeRange,
+		created:   d.incremental.now(),
+	}
+	if ok {
+		merged, err := mergeIncremental(prev.frame, frame, query, tail.TimeRange.From, query.TimeRange.From)
+		if err != nil {
+			logInfof("Incremental query fell back to full time range: %s", err)
+			d.incremental.delete(key)
+			return d.query(ctx, query)
+		}
+		entry.frame = merged
+		entry.created = prev.created
+	}
+	if queryTimeField(entry.frame, query) != nil {
+		d.incremental.set(key, entry)
+	}
+
+	// Formatting modifies the frame and its fields so hand it a copy.
+	out := copyFrame(entry.frame)
+	out.Meta = &data.FrameMeta{}
+	resp = frameDataResponse(out, nil, format, headers)
+	setCustomMeta(resp, "incremental", ok)
+	return resp
+}
+
+// extends reports whether the previous results can be extended to the time
+// range tr.
+func (e incrementalEntry) extends(tr backend.TimeRange, interval time.Duration, now time.Time) bool {
+	if now.Sub(e.created) >= incrementalMaxAge {
+		return false
+	}
+	if tr.From.Before(e.timeRange.From) || tr.To.Before(e.timeRange.To) {
+		return false
+	}
+	return e.tailFrom(interval).After(tr.From)
+}
+
+// tailFrom returns the start of the time range that has to be queried to
+// extend the previous results. It overlaps the end of the previous time range
+// by at least one interval and is aligned to the interval so that time buckets
+// are not split.
+func (e incrementalEntry) tailFrom(interval time.Duration) time.Time {
+	overlap := interval
+	if overlap < incrementalOverlap {
+		overlap = incrementalOverlap
+	}
+	from := e.timeRange.To.Add(-overlap)
+	if interval > 0 {
+		from = from.Truncate(interval)
+	}
+	return from
+}
+
+// mergeIncremental returns a new frame holding the rows of prev before
+// tailFrom followed by the rows of tail. Rows before from are trimmed.
+func mergeIncremental(prev, tail *data.Frame, query queryModel, tailFrom, from time.Time) (*data.Frame, error) {
+	if err := checkSameFields(prev, tail); err != nil {
+		return nil, err
+	}
+	prevTime, tailTime := queryTimeField(prev, query), queryTimeField(tail, query)
+	if prevTime == nil || tailTime == nil {
+		return nil, fmt.Errorf("no time column found")
+	}
+
+	merged := prev.EmptyCopy()
+	appendRows(merged, prev, keepTimes(prevTime, func(t time.Time) bool {
+		return !t.Before(from) && t.Before(tailFrom)
+	}))
+	appendRows(merged, tail, keepTimes(tailTime, func(t time.Time) bool {
+		return !t.Before(from)
+	}))
+	return merged, nil
+}
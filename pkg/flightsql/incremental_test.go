@@ -0,0 +1,241 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportsIncremental(t *testing.T) {
+	cs := []struct {
+		text   string
+		format sqlutil.FormatQueryOption
+		out    bool
+	}{
+		{text: `select * from x where $__timeRange(time)`, out: true},
+		{text: `select * from x where time >= $__timeFrom`, out: true},
+		{text: `select * from x where $__timeFrom<=time and time < $__timeTo`, out: true},
+		{text: `select * from x where time between $__timeFrom and $__timeTo`, out: true},
+		{text: `select date_bin($__interval, time, $__timeFrom) from x where time >= $__timeFrom`, out: false},
+		{text: `select $__timeFrom as start, v from x where $__timeRange(time)`, out: false},
+		{text: `select * from x where time < $__timeTo`, out: false},
+		{text: `select * from x`, out: false},
+		{text: `select * from x where $__timeRange(time) limit 10`, out: false},
+		{text: `select avg(v) over (order by time) from x where $__timeRange(time)`, out: false},
+		{text: `select * from x where $__timeRange(time)`, format: sqlutil.FormatOptionTable, out: false},
+	}
+	for _, c := range cs {
+		t.Run(c.text, func(t *testing.T) {
+			query := queryModel{Query: sqlutil.Query{Format: c.format}, Text: c.text}
+			require.Equal(t, c.out, supportsIncremental(query))
+		})
+	}
+}
+
+func TestIncrementalKey(t *testing.T) {
+	query := queryModel{
+		Query:        sqlutil.Query{Format: sqlutil.FormatOptionTimeSeries, Interval: time.Minute},
+		Text:         "select * from x where $__timeRange(time) and $__adhocFilters",
+		AdhocFilters: []adhocFilter{{Key: "host", Operator: "=", Value: "a"}},
+	}
+	key := incrementalKey(query)
+	require.Equal(t, key, incrementalKey(query))
+
+	for name, change := range map[string]func(q *queryModel){
+		"filters":     func(q *queryModel) { q.AdhocFilters = []adhocFilter{{Key: "host", Operator: "=", Value: "b"}} },
+		"no filters":  func(q *queryModel) { q.AdhocFilters = nil },
+		"quote":       func(q *queryModel) { q.IdentifierQuote = "`" },
+		"time column": func(q *queryModel) { q.TimeColumn = "ts" },
+		"time unit":   func(q *queryModel) { q.TimeUnit = time.Second },
+	} {
+		changed := query
+		change(&changed)
+		require.NotEqual(t, key, incrementalKey(changed), name)
+	}
+
+	// Filters are not part of the key of queries that do not use them.
+	query.Text = "select * from x where $__timeRange(time)"
+	changed := query
+	changed.AdhocFilters = nil
+	require.Equal(t, incrementalKey(query), incrementalKey(changed))
+}
+
+func TestIncrementalEntry(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	entry := incrementalEntry{
+		timeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+		created:   from.Add(time.Hour),
+	}
+
+	// The tail overlaps the previous time range and is aligned to the interval.
+	require.Equal(t, from.Add(59*time.Minute), entry.tailFrom(10*time.Second))
+	require.Equal(t, from.Add(50*time.Minute), entry.tailFrom(10*time.Minute))
+
+	now := entry.created.Add(10 * time.Second)
+	moved := backend.TimeRange{From: from.Add(10 * time.Second), To: from.Add(time.Hour + 10*time.Second)}
+	require.True(t, entry.extends(moved, time.Second, now))
+
+	// Time ranges moving backwards or expired results require a full query.
+	back := backend.TimeRange{From: from.Add(-time.Minute), To: from.Add(59 * time.Minute)}
+	require.False(t, entry.extends(back, time.Second, now))
+	require.False(t, entry.extends(moved, time.Second, now.Add(incrementalMaxAge)))
+
+	// Time ranges that moved past the previous one are queried in full.
+	past := backend.TimeRange{From: from.Add(2 * time.Hour), To: from.Add(3 * time.Hour)}
+	require.False(t, entry.extends(past, time.Second, now))
+}
+
+func TestMergeIncremental(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	prev := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(0), at(1), at(2), at(3)}),
+		data.NewField("value", nil, []int64{0, 1, 2, 3}),
+	)
+	tail := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(3), at(4)}),
+		data.NewField("value", nil, []int64{30, 4}),
+	)
+
+	merged, err := mergeIncremental(prev, tail, queryModel{}, at(3), at(1))
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{at(1), at(2), at(3), at(4)}, extractFieldValues[time.Time](t, merged.Fields[0]))
+	require.Equal(t, []int64{1, 2, 30, 4}, extractFieldValues[int64](t, merged.Fields[1]))
+
+	// The previous frame is left untouched.
+	require.Equal(t, 4, prev.Rows())
+
+	changed := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(3)}),
+		data.NewField("other", nil, []int64{3}),
+	)
+	_, err = mergeIncremental(prev, changed, queryModel{}, at(3), at(1))
+	require.Error(t, err)
+}
+
+// metricsTable creates a table of metrics reported by two hosts every minute
+// for 70 minutes from 2023-01-01T00:00:00Z. ts holds the time as seconds since
+// the epoch and at as an RFC 3339 string for the time macros to compare with.
+var metricsTable = []string{
+	`create table metrics (host text, ts integer, value real, at text)`,
+	`insert into metrics
+	with recursive m(k) as (select 0 union all select k + 1 from m where k < 70)
+	select h.host, 1672531200 + k * 60, k, strftime('%Y-%m-%dT%H:%M:%SZ', 1672531200 + k * 60, 'unixepoch')
+	from m, (select 'a' as host union all select 'b') h`,
+}
+
+func TestIntegration_QueryData_Incremental(t *testing.T) {
+	ds := newTestDatasource(t, config{}, metricsTable...)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	query := queryRequest{
+		RefID:                "A",
+		Text:                 "select host, ts, value from metrics where $__timeRange(at)",
+		Format:               "time_series",
+		IntervalMilliseconds: int(time.Minute.Milliseconds()),
+		TimeColumn:           "ts",
+		TimeUnit:             "s",
+	}
+
+	for i, incremental := range []bool{false, true, true} {
+		shift := time.Duration(i) * 2 * time.Minute
+		tr := backend.TimeRange{From: from.Add(shift), To: from.Add(time.Hour + shift)}
+
+		query.Incremental = true
+		resp := queryDataResponse(t, ds, query, tr)
+		require.NoError(t, resp.Error)
+		require.Equal(t, incremental, resp.Frames[0].Meta.Custom.(map[string]any)["incremental"])
+
+		// The stored results are left as they were queried.
+		entry, ok := ds.incremental.get(incrementalKey(queryModel{
+			Query:      sqlutil.Query{Format: sqlutil.FormatOptionTimeSeries, Interval: time.Minute},
+			Text:       query.Text,
+			TimeColumn: "ts",
+			TimeUnit:   time.Second,
+		}))
+		require.True(t, ok)
+		require.Equal(t, "host", entry.frame.Fields[0].Name)
+		require.Equal(t, data.FieldTypeNullableInt64, entry.frame.Fields[1].Type())
+
+		query.Incremental = false
+		full := queryDataResponse(t, ds, query, tr)
+		require.NoError(t, full.Error)
+		require.Equal(t, full.Frames[0].Fields, resp.Frames[0].Fields)
+		require.Equal(t, 61, resp.Frames[0].Rows())
+	}
+}
+
+// queryDataResponse executes the query through QueryData and returns its
+// response.
+func queryDataResponse(t *testing.T, ds *FlightSQLDatasource, query queryRequest, tr backend.TimeRange) backend.DataResponse {
+	t.Helper()
+
+	b, err := json.Marshal(query)
+	require.NoError(t, err)
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{{RefID: query.RefID, JSON: b, TimeRange: tr}},
+	})
+	require.NoError(t, err)
+	return resp.Responses[query.RefID]
+}
+
+func TestIntegration_QueryData_IncrementalFill(t *testing.T) {
+	ds := newTestDatasource(t, config{}, metricsTable...)
+
+	// Every tenth minute is missing from the results and filled.
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	query := queryRequest{
+		RefID:                "A",
+		Text:                 "select host, ts, value from metrics where $__timeRange(at) and ts % 600 != 0",
+		Format:               "time_series",
+		IntervalMilliseconds: int(time.Minute.Milliseconds()),
+		TimeColumn:           "ts",
+		TimeUnit:             "s",
+		FillMode:             "null",
+	}
+
+	for i, incremental := range []bool{false, true, true} {
+		shift := time.Duration(i) * 2 * time.Minute
+		tr := backend.TimeRange{From: from.Add(shift), To: from.Add(time.Hour + shift)}
+
+		query.Incremental = true
+		resp := queryDataResponse(t, ds, query, tr)
+		require.NoError(t, resp.Error)
+		require.Equal(t, incremental, resp.Frames[0].Meta.Custom.(map[string]any)["incremental"])
+
+		// Missing values are filled over the whole time range rather than
+		// only over the queried tail.
+		query.Incremental = false
+		full := queryDataResponse(t, ds, query, tr)
+		require.NoError(t, full.Error)
+		require.Equal(t, full.Frames[0].Fields, resp.Frames[0].Fields)
+		require.Equal(t, 61, resp.Frames[0].Rows())
+	}
+}
+
+func TestIntegration_QueryData_IncrementalUnsupported(t *testing.T) {
+	ds := newTestDatasource(t, config{}, metricsTable...)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	query := queryRequest{
+		RefID:       "A",
+		Text:        "select host, ts, value from metrics where $__timeRange(at) limit 10",
+		Format:      "time_series",
+		TimeColumn:  "ts",
+		TimeUnit:    "s",
+		Incremental: true,
+	}
+
+	// Queries that cannot be extended are executed in full and not stored.
+	resp := queryDataResponse(t, ds, query, backend.TimeRange{From: from, To: from.Add(time.Hour)})
+	require.NoError(t, resp.Error)
+	require.NotContains(t, resp.Frames[0].Meta.Custom.(map[string]any), "incremental")
+	require.Equal(t, 0, ds.incremental.lru.Len())
+}
@@ -0,0 +1,116 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// interpolateResponse is the response to an interpolate request.
+type interpolateResponse struct {
+	// SQL is the query with its macros expanded.
+	SQL string `json:"sql"`
+	// Macros are the macros expanded in the query, in the order of their
+	// first use in its text.
+	Macros []appliedMacro `json:"macros"`
+}
+
+// appliedMacro is the expansion of a macro in a query.
+type appliedMacro struct {
+	Name      string   `json:"name"`
+	Args      []string `json:"args"`
+	Expansion string   `json:"expansion"`
+}
+
+// postInterpolate expands the macros of a query without running it. The body
+// of the request is a [resourceQuery].
+func (d *FlightSQLDatasource) postInterpolate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxResourceQueryBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, _, err := d.decodeResourceQuery(ctx, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applied, err := appliedMacros(*query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(interpolateResponse{SQL: query.RawSQL, Macros: applied}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// appliedMacros expands the macros of the query again, recording each
+// distinct expansion.
+func appliedMacros(q queryModel) ([]appliedMacro, error) {
+	applied := []appliedMacro{}
+	seen := map[string]bool{}
+	record := func(m appliedMacro) {
+		key := m.Name + "\x00" + strings.Join(m.Args, "\x00") + "\x00" + m.Expansion
+		if !seen[key] {
+			seen[key] = true
+			applied = append(applied, m)
+		}
+	}
+
+	traced := sqlutil.Macros{}
+	for name, macro := range macros {
+		name, macro := name, macro
+		traced[name] = func(query *sqlutil.Query, args []string) (string, error) {
+			sql, err := macro(query, args)
+			if err == nil {
+				record(appliedMacro{Name: name, Args: args, Expansion: sql})
+			}
+			return sql, err
+		}
+	}
+	if _, err := q.interpolateMacros(traced); err != nil {
+		return nil, err
+	}
+	if adhocFiltersMacro.MatchString(q.Text) {
+		sql, err := adhocFiltersSQL(q.AdhocFilters, q.IdentifierQuote)
+		if err != nil {
+			return nil, err
+		}
+		record(appliedMacro{Name: "adhocFilters", Args: []string{}, Expansion: sql})
+	}
+
+	// List macros are expanded first and the others in no particular order,
+	// so expansions are sorted by the first use of their macro.
+	index := map[string]int{}
+	for _, m := range applied {
+		index[m.Name] = macroIndex(q.Text, m.Name)
+	}
+	sort.SliceStable(applied, func(i, j int) bool {
+		return index[applied[i].Name] < index[applied[j].Name]
+	})
+	return applied, nil
+}
+
+// macroIndex returns the index of the first use of a macro in text, or the
+// length of text if it is not used.
+func macroIndex(text, name string) int {
+	loc := regexp.MustCompile(`\$__` + regexp.QuoteMeta(name) + `\b`).FindStringIndex(text)
+	if loc == nil {
+		return len(text)
+	}
+	return loc[0]
+}
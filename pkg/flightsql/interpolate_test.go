@@ -0,0 +1,84 @@
+package flightsql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppliedMacros(t *testing.T) {
+	query, err := decodeQueryRequest(backend.DataQuery{
+		JSON: []byte(`{
+			"queryText": "select $__dateBin(ts), count(*) from t where $__timeFilter(ts) and $__in(host, 'a','b') and $__adhocFilters and $__timeFilter(ts) group by 1",
+			"intervalMs": 60000,
+			"adhocFilters": [{"key": "region", "operator": "=", "value": "us"}]
+		}`),
+		TimeRange: backend.TimeRange{
+			From: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}, func() string { return defaultIdentifierQuote })
+	require.NoError(t, err)
+
+	applied, err := appliedMacros(*query)
+	require.NoError(t, err)
+	require.Equal(t, []appliedMacro{
+		{
+			Name:      "dateBin",
+			Args:      []string{"ts"},
+			Expansion: "date_bin(interval '60 second', ts, timestamp '1970-01-01T00:00:00Z')",
+		},
+		{
+			Name:      "timeFilter",
+			Args:      []string{"ts"},
+			Expansion: "ts >= '2023-01-01T00:00:00Z' AND ts <= '2023-01-02T00:00:00Z'",
+		},
+		{
+			Name:      "in",
+			Args:      []string{"host", " 'a','b'"},
+			Expansion: "host in ('a', 'b')",
+		},
+		{
+			Name:      "adhocFilters",
+			Args:      []string{},
+			Expansion: `"region" = 'us'`,
+		},
+	}, applied)
+
+	query, err = decodeQueryRequest(backend.DataQuery{JSON: []byte(`{"queryText": "select 1"}`)}, func() string { return defaultIdentifierQuote })
+	require.NoError(t, err)
+	applied, err = appliedMacros(*query)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+}
+
+func TestIntegration_Interpolate(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	interpolate := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ds.postInterpolate(w, httptest.NewRequest(http.MethodPost, "/plugin/interpolate", strings.NewReader(body)))
+		return w
+	}
+
+	w := interpolate(`{"queryText": "select * from intTable where $__timeFilter(ts)", "from": 1672531200000, "to": 1672617600000}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp interpolateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "select * from intTable where ts >= '2023-01-01T00:00:00Z' AND ts <= '2023-01-02T00:00:00Z'", resp.SQL)
+	require.Equal(t, []appliedMacro{{
+		Name:      "timeFilter",
+		Args:      []string{"ts"},
+		Expansion: "ts >= '2023-01-01T00:00:00Z' AND ts <= '2023-01-02T00:00:00Z'",
+	}}, resp.Macros)
+
+	w = interpolate(`{"queryText": "select $__timeGroup(ts)"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "macro interpolation")
+}
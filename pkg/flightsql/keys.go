@@ -0,0 +1,83 @@
+package flightsql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/apache/arrow/go/v12/arrow/flight"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+	"google.golang.org/grpc"
+)
+
+// keysFunc is a method of [flightsql.Client] returning the keys of a table.
+type keysFunc func(context.Context, flightsql.TableRef, ...grpc.CallOption) (*flight.FlightInfo, error)
+
+// getPrimaryKeys lists the columns of the primary key of a table.
+func (d *FlightSQLDatasource) getPrimaryKeys(w http.ResponseWriter, r *http.Request) {
+	d.getKeys(w, r, d.client.GetPrimaryKeys)
+}
+
+// getExportedKeys lists the foreign keys referencing the primary key of a
+// table.
+func (d *FlightSQLDatasource) getExportedKeys(w http.ResponseWriter, r *http.Request) {
+	d.getKeys(w, r, d.client.GetExportedKeys)
+}
+
+// getImportedKeys lists the foreign keys of a table and the primary keys they
+// reference.
+func (d *FlightSQLDatasource) getImportedKeys(w http.ResponseWriter, r *http.Request) {
+	d.getKeys(w, r, d.client.GetImportedKeys)
+}
+
+// getKeys lists the keys returned by get for the table named by the catalog,
+// schema and table query parameters.
+func (d *FlightSQLDatasource) getKeys(w http.ResponseWriter, r *http.Request, get keysFunc) {
+	ref, err := d.tableRefParams(r.URL.Query(), "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.writeMetadata(w, r, func(ctx context.Context) (*flight.FlightInfo, error) {
+		return get(ctx, ref)
+	})
+}
+
+// getCrossReference lists the foreign keys of the table named by the
+// fk_catalog, fk_schema and fk_table query parameters that reference the
+// primary key of the table named by the pk_catalog, pk_schema and pk_table
+// query parameters.
+func (d *FlightSQLDatasource) getCrossReference(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	pk, err := d.tableRefParams(params, "pk_")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fk, err := d.tableRefParams(params, "fk_")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.writeMetadata(w, r, func(ctx context.Context) (*flight.FlightInfo, error) {
+		return d.client.GetCrossReference(ctx, pk, fk)
+	})
+}
+
+// tableRefParams returns the table named by the catalog, schema and table
+// query parameters with the given prefix. The default catalog and schema are
+// used if the parameters name none.
+func (d *FlightSQLDatasource) tableRefParams(params url.Values, prefix string) (flightsql.TableRef, error) {
+	table := params.Get(prefix + "table")
+	if table == "" {
+		return flightsql.TableRef{}, fmt.Errorf("query parameter %q is required", prefix+"table")
+	}
+	return flightsql.TableRef{
+		Catalog:  paramOrDefault(params, prefix+"catalog", d.defaultCatalog),
+		DBSchema: paramOrDefault(params, prefix+"schema", d.defaultSchema),
+		Table:    table,
+	}, nil
+}
@@ -0,0 +1,45 @@
+package flightsql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Keys(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	get := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	column := func(frame *data.Frame, name string) []string {
+		field, _ := frame.FieldByName(name)
+		require.NotNil(t, field, name)
+		return extractFieldValues[string](t, field)
+	}
+
+	frames := resourceFrames(t, get(ds.getPrimaryKeys, "/flightsql/primary-keys?table=intTable"))
+	require.Equal(t, []string{"id"}, column(frames[0], "column_name"))
+
+	frames = resourceFrames(t, get(ds.getExportedKeys, "/flightsql/exported-keys?table=foreignTable"))
+	require.Equal(t, []string{"intTable"}, column(frames[0], "fk_table_name"))
+	require.Equal(t, []string{"foreignId"}, column(frames[0], "fk_column_name"))
+
+	frames = resourceFrames(t, get(ds.getImportedKeys, "/flightsql/imported-keys?table=intTable"))
+	require.Equal(t, []string{"foreignTable"}, column(frames[0], "pk_table_name"))
+	require.Equal(t, []string{"id"}, column(frames[0], "pk_column_name"))
+
+	frames = resourceFrames(t, get(ds.getCrossReference, "/flightsql/cross-reference?pk_table=foreignTable&fk_table=intTable"))
+	require.Equal(t, []string{"foreignId"}, column(frames[0], "fk_column_name"))
+
+	frames = resourceFrames(t, get(ds.getCrossReference, "/flightsql/cross-reference?pk_table=intTable&fk_table=foreignTable"))
+	require.Equal(t, 0, frames[0].Rows())
+
+	require.Equal(t, http.StatusBadRequest, get(ds.getPrimaryKeys, "/flightsql/primary-keys").Code)
+	require.Equal(t, http.StatusBadRequest, get(ds.getCrossReference, "/flightsql/cross-reference?pk_table=intTable").Code)
+}
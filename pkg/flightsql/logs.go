@@ -0,0 +1,348 @@
+package flightsql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// defaultLogsContextLimit is the number of log lines returned by a logs
+	// context query that does not set a limit.
+	defaultLogsContextLimit = 10
+	// maxLogsContextLimit bounds the number of log lines returned by a logs
+	// context query.
+	maxLogsContextLimit = 1000
+	// logsVolumeBuckets is the number of buckets the time range of a logs
+	// volume query is split into when the query has no interval. Buckets are
+	// at least a second long.
+	logsVolumeBuckets = 100
+)
+
+var (
+	// logsBodyColumns are the names of columns detected as the body of log
+	// lines, in order of preference.
+	logsBodyColumns = []string{"body", "message", "msg", "line", "log"}
+	// logsSeverityColumns are the names of columns detected as the severity
+	// of log lines, in order of preference.
+	logsSeverityColumns = []string{"severity", "severity_text", "level", "log_level", "loglevel"}
+)
+
+// logsContextDirections maps the directions accepted in logs context queries
+// to the comparison and sort order selecting the log lines in that direction.
+var logsContextDirections = map[string]struct{ op, order string }{
+	"":         {op: "<", order: "desc"},
+	"backward": {op: "<", order: "desc"},
+	"forward":  {op: ">", order: "asc"},
+}
+
+// logsContextSQL returns the SQL of a logs context query, which selects the
+// log lines of a query right before or after a log line. The time column is
+// quoted with quote.
+func logsContextSQL(q queryRequest, quote string) (string, error) {
+	statements := splitStatements(q.Text)
+	if len(statements) != 1 {
+		return "", fmt.Errorf("logs context queries must consist of a single statement")
+	}
+	if q.TimeColumn == "" {
+		return "", fmt.Errorf("logs context queries require a time column")
+	}
+	direction, ok := logsContextDirections[q.ContextDirection]
+	if !ok {
+		return "", fmt.Errorf("unsupported logs context direction: %q", q.ContextDirection)
+	}
+	limit := q.ContextLimit
+	if limit <= 0 {
+		limit = defaultLogsContextLimit
+	}
+	if limit > maxLogsContextLimit {
+		limit = maxLogsContextLimit
+	}
+
+	at := logsContextTime(q, direction.op)
+	literal := fmt.Sprintf("cast('%s' as timestamp)", at.Format(time.RFC3339Nano))
+	if unit, ok := timeUnits[q.TimeUnit]; ok {
+		literal = fmt.Sprint(at.UnixNano() / int64(unit))
+	}
+
+	column := quoteIdentifier(q.TimeColumn, quote)
+	return fmt.Sprintf("select * from (%s) as logs where %s %s %s order by %s %s limit %d",
+		statements[0].Text, column, direction.op, literal, column, direction.order, limit), nil
+}
+
+// logsContextTime returns the time of the log line a logs context query is
+// anchored to. The time is given in nanoseconds at full precision or in
+// milliseconds. Log lines within the millisecond of an anchor given in
+// milliseconds cannot be ordered relative to it, so they are excluded in both
+// directions rather than returning the anchor itself.
+func logsContextTime(q queryRequest, op string) time.Time {
+	if q.ContextTimeNanoseconds != 0 {
+		return time.Unix(0, q.ContextTimeNanoseconds).UTC()
+	}
+	at := time.UnixMilli(q.ContextTimeMilliseconds).UTC()
+	if op == ">" {
+		at = at.Add(time.Millisecond - time.Nanosecond)
+	}
+	return at
+}
+
+// logsFrame converts the results of a logs query into a frame of log lines
+// with timestamp, body, severity and labels fields. The time, body and
+// severity columns are those named by the query or detected by their type and
+// name. The labels of a log line are the values of the label columns named by
+// the query or of all other columns. Rows without a time are dropped.
+func logsFrame(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	times := queryTimeField(frame, query)
+	if times == nil {
+		if query.TimeColumn != "" {
+			return nil, fmt.Errorf("time column %q not found", query.TimeColumn)
+		}
+		return nil, fmt.Errorf("no time column found")
+	}
+
+	body, err := logsColumn(frame, query.BodyColumn, logsBodyColumns, "body")
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		body = firstStringField(frame, query)
+	}
+	if body == nil {
+		return nil, fmt.Errorf("no body column found")
+	}
+	severity, err := logsColumn(frame, query.SeverityColumn, logsSeverityColumns, "severity")
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := logsLabels(frame, query, body, severity)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		timestamps = []time.Time{}
+		bodies     = []string{}
+		severities = []string{}
+		labelSets  = []json.RawMessage{}
+	)
+	for i := 0; i < frame.Rows(); i++ {
+		t, ok := times.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		timestamps = append(timestamps, t.(time.Time))
+		bodies = append(bodies, labelAt(body, i))
+		if severity != nil {
+			severities = append(severities, labelAt(severity, i))
+		}
+
+		set := map[string]string{}
+		for _, field := range labels {
+			if v, ok := field.ConcreteAt(i); ok {
+				set[field.Name] = fmt.Sprint(v)
+			}
+		}
+		b, err := json.Marshal(set)
+		if err != nil {
+			return nil, err
+		}
+		labelSets = append(labelSets, b)
+	}
+
+	out := data.NewFrame(frame.Name,
+		data.NewField("timestamp", nil, timestamps),
+		data.NewField("body", nil, bodies),
+	)
+	if severity != nil {
+		out.Fields = append(out.Fields, data.NewField("severity", nil, severities))
+	}
+	out.Fields = append(out.Fields, data.NewField("labels", nil, labelSets))
+
+	out.Meta = frame.Meta
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+	out.Meta.Type = data.FrameTypeLogLines
+	out.Meta.PreferredVisualization = data.VisTypeLogs
+	return out, nil
+}
+
+// logsColumn returns the field of the column named by the query or, if the
+// query names none, the first string field with one of the detected names. It
+// returns nil if no column is detected.
+func logsColumn(frame *data.Frame, column string, detect []string, kind string) (*data.Field, error) {
+	if column != "" {
+		field, idx := frame.FieldByName(column)
+		if idx == -1 {
+			return nil, fmt.Errorf("%s column %q not found", kind, column)
+		}
+		return field, nil
+	}
+	for _, name := range detect {
+		for _, field := range frame.Fields {
+			if strings.EqualFold(field.Name, name) && isStringField(field) {
+				return field, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// firstStringField returns the first string field of the frame that is not
+// the time column of the query.
+func firstStringField(frame *data.Frame, query queryModel) *data.Field {
+	for _, field := range frame.Fields {
+		if isStringField(field) && field.Name != query.TimeColumn {
+			return field
+		}
+	}
+	return nil
+}
+
+// logsLabels returns the fields of the label columns of a logs query.
+func logsLabels(frame *data.Frame, query queryModel, body, severity *data.Field) ([]*data.Field, error) {
+	if len(query.LabelColumns) > 0 {
+		labels := make([]*data.Field, 0, len(query.LabelColumns))
+		for _, column := range query.LabelColumns {
+			field, idx := frame.FieldByName(column)
+			if idx == -1 {
+				return nil, fmt.Errorf("label column %q not found", column)
+			}
+			labels = append(labels, field)
+		}
+		return labels, nil
+	}
+
+	times := timeFieldIndex(frame, query.TimeColumn)
+	var labels []*data.Field
+	for i, field := range frame.Fields {
+		if i == times || field == body || field == severity || field.Name == query.TimeColumn {
+			continue
+		}
+		labels = append(labels, field)
+	}
+	return labels, nil
+}
+
+// logsVolumeSQL returns the SQL of a logs volume query, which counts the log
+// lines of a query per interval of the query and severity. The log lines are
+// counted by the server rather than downloaded. They are grouped by the
+// severity column named by the query, or only by time if it names none.
+// Identifiers are quoted with quote.
+func logsVolumeSQL(q queryRequest, tr backend.TimeRange, quote string) (string, error) {
+	statements := splitStatements(q.Text)
+	if len(statements) != 1 {
+		return "", fmt.Errorf("logs volume queries must consist of a single statement")
+	}
+	if q.TimeColumn == "" {
+		return "", fmt.Errorf("logs volume queries require a time column")
+	}
+
+	interval := time.Duration(q.IntervalMilliseconds) * time.Millisecond
+	if interval <= 0 {
+		interval = tr.To.Sub(tr.From) / logsVolumeBuckets
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	column := quoteIdentifier(q.TimeColumn, quote)
+	bucket := fmt.Sprintf("date_bin(interval '%d second', %s, timestamp '1970-01-01T00:00:00Z')", int64(interval/time.Second), column)
+	if unit, ok := timeUnits[q.TimeUnit]; ok {
+		// Numeric time columns are binned by their epoch value.
+		width := int64(interval / unit)
+		if width < 1 {
+			width = 1
+		}
+		bucket = fmt.Sprintf("%s - %s %% %d", column, column, width)
+	}
+
+	if q.SeverityColumn == "" {
+		return fmt.Sprintf("select %s as %s, count(*) as %s from (%s) as logs where %s is not null group by 1 order by 1",
+			bucket, column, quoteIdentifier("count", quote), statements[0].Text, column), nil
+	}
+	return fmt.Sprintf("select %s as %s, %s as %s, count(*) as %s from (%s) as logs where %s is not null group by 1, 2 order by 1",
+		bucket, column, quoteIdentifier(q.SeverityColumn, quote), quoteIdentifier("level", quote), quoteIdentifier("count", quote), statements[0].Text, column), nil
+}
+
+// logsVolume converts the results of a logs volume query, counts of log lines
+// per time and level, into a wide time series frame with a count field per
+// level.
+func logsVolume(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	times := queryTimeField(frame, query)
+	if times == nil {
+		return nil, fmt.Errorf("time column %q not found", query.TimeColumn)
+	}
+	count, _ := frame.FieldByName("count")
+	if count == nil {
+		return nil, fmt.Errorf("count column not found")
+	}
+	level, _ := frame.FieldByName("level")
+
+	var (
+		counts  = map[string]map[time.Time]int64{}
+		buckets = map[time.Time]struct{}{}
+	)
+	for i := 0; i < frame.Rows(); i++ {
+		if isNull(times, i) {
+			continue
+		}
+		bucket := timeAt(times, i)
+		name := ""
+		if level != nil {
+			name = labelAt(level, i)
+		}
+		n, err := count.FloatAt(i)
+		if err != nil {
+			return nil, err
+		}
+		if counts[name] == nil {
+			counts[name] = map[time.Time]int64{}
+		}
+		counts[name][bucket] += int64(n)
+		buckets[bucket] = struct{}{}
+	}
+
+	timestamps := make([]time.Time, 0, len(buckets))
+	for t := range buckets {
+		timestamps = append(timestamps, t)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+	levels := make([]string, 0, len(counts))
+	for name := range counts {
+		levels = append(levels, name)
+	}
+	sort.Strings(levels)
+
+	out := data.NewFrame(frame.Name, data.NewField("time", nil, timestamps))
+	for _, name := range levels {
+		values := make([]int64, len(timestamps))
+		for i, t := range timestamps {
+			values[i] = counts[name][t]
+		}
+		var labels data.Labels
+		if level != nil {
+			labels = data.Labels{"level": name}
+		}
+		out.Fields = append(out.Fields, data.NewField("count", labels, values))
+	}
+
+	out.Meta = frame.Meta
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+	out.Meta.Type = data.FrameTypeTimeSeriesWide
+	out.Meta.PreferredVisualization = data.VisTypeGraph
+	return out, nil
+}
+
+// isStringField reports whether the field holds strings.
+func isStringField(field *data.Field) bool {
+	return field.Type() == data.FieldTypeString || field.Type() == data.FieldTypeNullableString
+}
@@ -0,0 +1,219 @@
+package flightsql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogsFrame(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	newFrame := func() *data.Frame {
+		return data.NewFrame("",
+			data.NewField("service", nil, []string{"api", "db"}),
+			data.NewField("Message", nil, []string{"started", "slow query"}),
+			data.NewField("time", nil, []*time.Time{&ts, nil}),
+			data.NewField("level", nil, []string{"info", "warn"}),
+			data.NewField("duration", nil, []*int64{nil, ptr[int64](5)}),
+		)
+	}
+
+	t.Run("detect", func(t *testing.T) {
+		out, err := logsFrame(newFrame(), queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, data.FrameTypeLogLines, out.Meta.Type)
+		require.Equal(t, data.VisType(data.VisTypeLogs), out.Meta.PreferredVisualization)
+
+		// Rows without a time are dropped.
+		require.Equal(t, []time.Time{ts}, extractFieldValues[time.Time](t, out.Fields[0]))
+		require.Equal(t, "body", out.Fields[1].Name)
+		require.Equal(t, []string{"started"}, extractFieldValues[string](t, out.Fields[1]))
+		require.Equal(t, "severity", out.Fields[2].Name)
+		require.Equal(t, []string{"info"}, extractFieldValues[string](t, out.Fields[2]))
+		require.Equal(t, "labels", out.Fields[3].Name)
+		require.Equal(t, []json.RawMessage{json.RawMessage(`{"service":"api"}`)}, extractFieldValues[json.RawMessage](t, out.Fields[3]))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		query := queryModel{
+			BodyColumn:     "service",
+			SeverityColumn: "Message",
+			LabelColumns:   []string{"duration", "level"},
+			TimeColumn:     "time",
+		}
+		frame := newFrame()
+		frame.Fields[2] = data.NewField("time", nil, []*time.Time{&ts, &ts})
+
+		out, err := logsFrame(frame, query)
+		require.NoError(t, err)
+		require.Equal(t, []string{"api", "db"}, extractFieldValues[string](t, out.Fields[1]))
+		require.Equal(t, []string{"started", "slow query"}, extractFieldValues[string](t, out.Fields[2]))
+		require.Equal(t, []json.RawMessage{
+			json.RawMessage(`{"level":"info"}`),
+			json.RawMessage(`{"duration":"5","level":"warn"}`),
+		}, extractFieldValues[json.RawMessage](t, out.Fields[3]))
+	})
+
+	t.Run("missing columns", func(t *testing.T) {
+		_, err := logsFrame(newFrame(), queryModel{BodyColumn: "missing"})
+		require.EqualError(t, err, `body column "missing" not found`)
+		_, err = logsFrame(newFrame(), queryModel{LabelColumns: []string{"missing"}})
+		require.EqualError(t, err, `label column "missing" not found`)
+
+		noTime := data.NewFrame("", data.NewField("body", nil, []string{"a"}))
+		_, err = logsFrame(noTime, queryModel{})
+		require.EqualError(t, err, "no time column found")
+	})
+}
+
+func TestLogsVolume(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	counts := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(0), at(0), at(10)}),
+		data.NewField("level", nil, []string{"error", "info", "info"}),
+		data.NewField("count", nil, []int64{1, 2, 1}),
+	)
+	counts.Meta = &data.FrameMeta{}
+
+	volume, err := logsVolume(counts, queryModel{TimeColumn: "time"})
+	require.NoError(t, err)
+	require.Equal(t, data.FrameTypeTimeSeriesWide, volume.Meta.Type)
+	require.Equal(t, []time.Time{at(0), at(10)}, extractFieldValues[time.Time](t, volume.Fields[0]))
+	require.Equal(t, data.Labels{"level": "error"}, volume.Fields[1].Labels)
+	require.Equal(t, []int64{1, 0}, extractFieldValues[int64](t, volume.Fields[1]))
+	require.Equal(t, data.Labels{"level": "info"}, volume.Fields[2].Labels)
+	require.Equal(t, []int64{2, 1}, extractFieldValues[int64](t, volume.Fields[2]))
+
+	_, err = logsVolume(counts, queryModel{TimeColumn: "missing"})
+	require.EqualError(t, err, `time column "missing" not found`)
+}
+
+func TestLogsVolumeSQL(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	q := queryRequest{
+		Text:                 "select * from logs where $__timeRange(time);",
+		TimeColumn:           "time",
+		SeverityColumn:       "level",
+		IntervalMilliseconds: int(time.Minute.Milliseconds()),
+	}
+
+	sql, err := logsVolumeSQL(q, tr, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select date_bin(interval '60 second', "time", timestamp '1970-01-01T00:00:00Z') as "time", "level" as "level", count(*) as "count" from (select * from logs where $__timeRange(time)) as logs where "time" is not null group by 1, 2 order by 1`, sql)
+
+	// Without an interval the time range is split into buckets and numeric
+	// time columns are binned by their value.
+	q.IntervalMilliseconds = 0
+	q.SeverityColumn = ""
+	q.TimeUnit = "ms"
+	sql, err = logsVolumeSQL(q, tr, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select "time" - "time" % 36000 as "time", count(*) as "count" from (select * from logs where $__timeRange(time)) as logs where "time" is not null group by 1 order by 1`, sql)
+
+	_, err = logsVolumeSQL(queryRequest{Text: "select 1"}, tr, defaultIdentifierQuote)
+	require.EqualError(t, err, "logs volume queries require a time column")
+}
+
+func TestLogsContextSQL(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	q := queryRequest{
+		Text:                    "select * from logs where $__timeRange(time);",
+		TimeColumn:              "time",
+		ContextTimeMilliseconds: ts.UnixMilli(),
+	}
+
+	sql, err := logsContextSQL(q, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select * from (select * from logs where $__timeRange(time)) as logs where "time" < cast('2023-01-01T00:00:00Z' as timestamp) order by "time" desc limit 10`, sql)
+
+	q.ContextDirection = "forward"
+	q.ContextLimit = 5
+	q.TimeUnit = "s"
+	sql, err = logsContextSQL(q, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select * from (select * from logs where $__timeRange(time)) as logs where "time" > 1672531200 order by "time" asc limit 5`, sql)
+
+	// Log lines within the millisecond of an anchor given in milliseconds are
+	// excluded rather than returning the anchor again.
+	q.TimeUnit = ""
+	sql, err = logsContextSQL(q, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select * from (select * from logs where $__timeRange(time)) as logs where "time" > cast('2023-01-01T00:00:00.000999999Z' as timestamp) order by "time" asc limit 5`, sql)
+
+	// Anchors given in nanoseconds are used at full precision.
+	q.ContextTimeNanoseconds = ts.Add(1500 * time.Nanosecond).UnixNano()
+	sql, err = logsContextSQL(q, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select * from (select * from logs where $__timeRange(time)) as logs where "time" > cast('2023-01-01T00:00:00.0000015Z' as timestamp) order by "time" asc limit 5`, sql)
+	q.TimeUnit = "ns"
+	sql, err = logsContextSQL(q, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Contains(t, sql, `where "time" > 1672531200000001500 order by`)
+
+	q.ContextDirection = "sideways"
+	_, err = logsContextSQL(q, defaultIdentifierQuote)
+	require.Error(t, err)
+
+	_, err = logsContextSQL(queryRequest{Text: "select 1"}, defaultIdentifierQuote)
+	require.EqualError(t, err, "logs context queries require a time column")
+}
+
+// logsTable creates a table of log lines written every minute from
+// 2023-01-01T00:00:00Z with ts holding the time as seconds since the epoch.
+var logsTable = []string{
+	`create table logs (ts integer, message text, level text, service text)`,
+	`insert into logs values
+	(1672531200, 'started', 'info', 'api'),
+	(1672531260, 'slow query', 'warn', 'db'),
+	(1672531320, 'request failed', 'error', 'api'),
+	(1672531380, 'stopped', 'info', 'api')`,
+}
+
+func TestIntegration_QueryData_Logs(t *testing.T) {
+	ds := newTestDatasource(t, config{}, logsTable...)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	query := queryRequest{
+		RefID:                "A",
+		Text:                 "select ts, message, level, service from logs",
+		Format:               "logs",
+		TimeColumn:           "ts",
+		TimeUnit:             "s",
+		IntervalMilliseconds: int(time.Hour.Milliseconds()),
+	}
+
+	resp := queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Equal(t, data.FrameTypeLogLines, resp.Frames[0].Meta.Type)
+	require.Equal(t, 4, resp.Frames[0].Rows())
+
+	query.QueryType = string(queryTypeLogsVolume)
+	query.SeverityColumn = "level"
+	resp = queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	volume := resp.Frames[0]
+	require.Len(t, volume.Fields, 4)
+	require.Equal(t, data.Labels{"level": "info"}, volume.Fields[2].Labels)
+	require.Equal(t, []int64{2}, extractFieldValues[int64](t, volume.Fields[2]))
+
+	query.Format = "table"
+	resp = queryDataResponse(t, ds, query, tr)
+	require.Equal(t, backend.StatusBadRequest, resp.Status)
+	query.Format = "logs"
+	query.SeverityColumn = ""
+
+	query.QueryType = string(queryTypeLogsContext)
+	query.ContextTimeMilliseconds = from.Add(2 * time.Minute).UnixMilli()
+	query.ContextLimit = 1
+	resp = queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Equal(t, []string{"slow query"}, extractFieldValues[string](t, resp.Frames[0].Fields[1]))
+}
@@ -2,26 +2,427 @@ package flightsql
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
 )
 
-var macros = sqlutil.Macros{
-	"dateBin":        macroDateBin(""),
-	"dateBinAlias":   macroDateBin("_binned"),
-	"interval":       macroInterval,
-	"timeGroup":      macroTimeGroup,
-	"timeGroupAlias": macroTimeGroupAlias,
+// macroDef registers a macro along with its documentation, which is served
+// from /plugin/macros.
+type macroDef struct {
+	Name string
+	// Func expands the macro. It is nil for macros that are not expanded by
+	// [sqlutil.Interpolate] such as $__adhocFilters.
+	Func sqlutil.MacroFunc
+	// Signature is the macro as written in a query with its arguments named.
+	Signature   string
+	Description string
+	Args        []macroArg
+	// Example is a query using the macro. Its expansion is previewed for
+	// [previewQuery].
+	Example string
+	// Hidden macros are not advertised by /plugin/macros.
+	Hidden bool
+}
+
+// macroArg documents an argument of a macro.
+type macroArg struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// macroRegistry holds the macros supported in queries.
+var macroRegistry = []macroDef{
+	{
+		Name:        "dateBin",
+		Func:        macroDateBin(""),
+		Signature:   "$__dateBin(column)",
+		Description: "Bins the time column into intervals of the query interval.",
+		Args:        []macroArg{{"column", "The time column to bin."}},
+		Example:     "select $__dateBin(time), avg(usage) from cpu group by 1",
+	},
+	{
+		Name:        "dateBinAlias",
+		Func:        macroDateBin("_binned"),
+		Signature:   "$__dateBinAlias(column)",
+		Description: "Bins the time column into intervals of the query interval, aliased as the column suffixed with _binned.",
+		Args:        []macroArg{{"column", "The time column to bin."}},
+		Example:     "select $__dateBinAlias(time), avg(usage) from cpu group by 1",
+	},
+	{
+		Name:        "interval",
+		Func:        macroInterval,
+		Signature:   "$__interval",
+		Description: "The interval of the query in seconds as a SQL interval.",
+		Example:     "select date_bin($__interval, time) as time, avg(usage) from cpu group by 1",
+	},
+	{
+		Name:        "timeGroup",
+		Func:        macroTimeGroup,
+		Signature:   "$__timeGroup(column, unit)",
+		Description: "Groups the time column by its date parts from the year down to the unit.",
+		Args: []macroArg{
+			{"column", "The time column to group."},
+			{"unit", "The smallest date part: year, month, day, hour or minute."},
+		},
+		Example: "select $__timeGroup(time, hour), avg(usage) from cpu group by 1",
+	},
+	{
+		Name:        "timeGroupAlias",
+		Func:        macroTimeGroupAlias,
+		Signature:   "$__timeGroupAlias(column, unit)",
+		Description: "Groups the time column by its date parts from the year down to the unit, aliased as the column suffixed with the date part.",
+		Args: []macroArg{
+			{"column", "The time column to group."},
+			{"unit", "The smallest date part: year, month, day, hour or minute."},
+		},
+		Example: "select $__timeGroupAlias(time, hour), avg(usage) from cpu group by 1",
+	},
+	{
+		Name:        "timeFilter",
+		Func:        sqlutil.DefaultMacros["timeFilter"],
+		Signature:   "$__timeFilter(column)",
+		Description: "Filters the time column by the time range of the query.",
+		Args:        []macroArg{{"column", "The time column to filter."}},
+		Example:     "select * from cpu where $__timeFilter(time)",
+	},
 
 	// The behaviors of timeFrom and timeTo as defined in the SDK are different
 	// from all other Grafana SQL plugins. Instead we'll take their
 	// implementations, rename them and define timeFrom and timeTo ourselves.
-	"timeRangeFrom": sqlutil.DefaultMacros["timeFrom"],
-	"timeRangeTo":   sqlutil.DefaultMacros["timeTo"],
-	"timeRange":     sqlutil.DefaultMacros["timeFilter"],
-	"timeTo":        macroTo,
-	"timeFrom":      macroFrom,
+	{
+		Name:        "timeRangeFrom",
+		Func:        sqlutil.DefaultMacros["timeFrom"],
+		Signature:   "$__timeRangeFrom(column)",
+		Description: "Filters the time column by the start of the time range of the query.",
+		Args:        []macroArg{{"column", "The time column to filter."}},
+		Example:     "select * from cpu where $__timeRangeFrom(time)",
+	},
+	{
+		Name:        "timeRangeTo",
+		Func:        sqlutil.DefaultMacros["timeTo"],
+		Signature:   "$__timeRangeTo(column)",
+		Description: "Filters the time column by the end of the time range of the query.",
+		Args:        []macroArg{{"column", "The time column to filter."}},
+		Example:     "select * from cpu where $__timeRangeTo(time)",
+	},
+	{
+		Name:        "timeRange",
+		Func:        sqlutil.DefaultMacros["timeFilter"],
+		Signature:   "$__timeRange(column)",
+		Description: "Filters the time column by the time range of the query.",
+		Args:        []macroArg{{"column", "The time column to filter."}},
+		Example:     "select * from cpu where $__timeRange(time)",
+	},
+	{
+		Name:        "timeFrom",
+		Func:        macroFrom,
+		Signature:   "$__timeFrom",
+		Description: "The start of the time range of the query as a timestamp.",
+		Example:     "select * from cpu where time >= $__timeFrom",
+	},
+	{
+		Name:        "timeTo",
+		Func:        macroTo,
+		Signature:   "$__timeTo",
+		Description: "The end of the time range of the query as a timestamp.",
+		Example:     "select * from cpu where time <= $__timeTo",
+	},
+
+	{
+		Name:        "in",
+		Func:        macroIn,
+		Signature:   "$__in(column, values)",
+		Description: "Filters the column by the values of a multi-value template variable. Selecting All omits the filter.",
+		Args: []macroArg{
+			{"column", "The column to filter."},
+			{"values", "The template variable, as in $host."},
+		},
+		Example: "select * from cpu where $__in(host, 'a','b')",
+	},
+	{
+		Name:        "csvQuoted",
+		Func:        macroCSVQuoted,
+		Signature:   "$__csvQuoted(values)",
+		Description: "The values of a multi-value template variable as a comma separated list of SQL strings.",
+		Args:        []macroArg{{"values", "The template variable, as in $host."}},
+		Example:     "select * from cpu where host in ($__csvQuoted('a','b'))",
+	},
+	{
+		Name:        "adhocFilters",
+		Signature:   "$__adhocFilters",
+		Description: "The predicates of the ad-hoc filters of the dashboard, or 1 = 1 without filters.",
+		Example:     "select * from cpu where $__adhocFilters",
+	},
+
+	// The SDK adds its default macros to the macros it interpolates, so they
+	// are registered here to keep the macros complete. We don't have the
+	// information available for these to function properly so they are not
+	// advertised.
+	{
+		Name:        "table",
+		Func:        sqlutil.DefaultMacros["table"],
+		Signature:   "$__table",
+		Description: "The table of the query, which is always empty since queries do not name one.",
+		Example:     "select $__table",
+		Hidden:      true,
+	},
+	{
+		Name:        "column",
+		Func:        sqlutil.DefaultMacros["column"],
+		Signature:   "$__column",
+		Description: "The column of the query, which is always empty since queries do not name one.",
+		Example:     "select $__column",
+		Hidden:      true,
+	},
+}
+
+// macros holds the functions of the registered macros.
+var macros = func() sqlutil.Macros {
+	m := sqlutil.Macros{}
+	for _, def := range macroRegistry {
+		if def.Func != nil {
+			m[def.Name] = def.Func
+		}
+	}
+	return m
+}()
+
+// previewQuery is the query for which the expansions of the examples of the
+// macros are previewed.
+var previewQuery = queryModel{
+	Query: sqlutil.Query{
+		Interval: time.Minute,
+		TimeRange: backend.TimeRange{
+			From: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2023, 1, 1, 1, 0, 0, 0, time.UTC),
+		},
+	},
+	AdhocFilters:    []adhocFilter{{Key: "host", Operator: "=", Value: "a"}},
+	IdentifierQuote: defaultIdentifierQuote,
+}
+
+// preview returns the example of the macro with its macros expanded for
+// [previewQuery].
+func (def macroDef) preview() (string, error) {
+	q := previewQuery
+	q.Text = def.Example
+	q, err := q.interpolate()
+	if err != nil {
+		return "", err
+	}
+	return q.RawSQL, nil
+}
+
+// listMacro matches the start of the list macros, whose arguments are the
+// values of template variables.
+var listMacro = regexp.MustCompile(`\$__(in|csvQuoted)\(`)
+
+// expandListMacros expands the list macros of m in the SQL of the query. They
+// are expanded before the other macros since their arguments are SQL strings
+// that may contain commas, parentheses and spaces, which the argument parsing
+// of [sqlutil.Interpolate] splits on or trims.
+func expandListMacros(query *sqlutil.Query, m sqlutil.Macros) (string, error) {
+	var (
+		b    strings.Builder
+		text = query.RawSQL
+	)
+	for {
+		loc := listMacro.FindStringSubmatchIndex(text)
+		if loc == nil {
+			b.WriteString(text)
+			return b.String(), nil
+		}
+		name := text[loc[2]:loc[3]]
+		args, end, ok := listMacroArgs(text[loc[1]:])
+		if !ok {
+			return "", fmt.Errorf("unterminated $__%s macro", name)
+		}
+		if name != "in" {
+			args = []string{strings.Join(args, ",")}
+		}
+
+		sql, err := m[name](query, args)
+		if err != nil {
+			return "", fmt.Errorf("$__%s: %w", name, err)
+		}
+		b.WriteString(text[:loc[0]])
+		b.WriteString(sql)
+		text = text[loc[1]+end:]
+	}
+}
+
+// listMacroArgs returns the arguments of a list macro from the text following
+// its opening parenthesis, split on the first comma outside of parentheses
+// and quotes, and the length of the text up to and including the closing
+// parenthesis. It reports false if the arguments are not terminated.
+func listMacroArgs(text string) (args []string, end int, ok bool) {
+	var (
+		depth  int
+		quoted bool
+		comma  = -1
+	)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ',' && depth == 0 && comma == -1:
+			comma = i
+		case c == ')' && depth > 0:
+			depth--
+		case c == ')':
+			if comma == -1 {
+				return []string{strings.TrimSpace(text[:i])}, i + 1, true
+			}
+			return []string{strings.TrimSpace(text[:comma]), text[comma+1 : i]}, i + 1, true
+		}
+	}
+	return nil, 0, false
+}
+
+// allValue is the value of template variables with "All" selected when the
+// variable sets no custom all value.
+const allValue = "$__all"
+
+// listValue is a value of a multi-value template variable passed to a list
+// macro.
+type listValue struct {
+	text string
+	// quoted is true if the value was a quoted SQL string.
+	quoted bool
+}
+
+// decimalLiteral matches the numbers that are valid SQL numeric literals.
+// Other values accepted by [strconv.ParseFloat] such as NaN, Inf and hex
+// floats are not.
+var decimalLiteral = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][-+]?\d+)?$`)
+
+// literal returns the value as a SQL literal. Unquoted decimal numbers are
+// kept as they are unless quote is true, and everything else becomes an
+// escaped string.
+func (v listValue) literal(quote bool) string {
+	if !quote && !v.quoted && decimalLiteral.MatchString(v.text) {
+		return v.text
+	}
+	return "'" + strings.ReplaceAll(v.text, "'", "''") + "'"
+}
+
+// parseListValues parses the values of a template variable as interpolated
+// by the frontend, either a comma separated list of quoted SQL strings for
+// multi-value variables or a bare value. Quotes in bare values are escaped by
+// doubling them. It reports whether "All" is selected. Macro arguments are
+// split on commas, so the arguments are joined back before parsing to keep
+// commas inside quoted values.
+func parseListValues(args []string) (values []listValue, all bool, err error) {
+	list := strings.TrimSpace(strings.Join(args, ","))
+	for list != "" {
+		var v listValue
+		if list[0] == '\'' {
+			var b strings.Builder
+			i := 1
+			for ; i < len(list); i++ {
+				if list[i] != '\'' {
+					b.WriteByte(list[i])
+					continue
+				}
+				if i+1 < len(list) && list[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			if i >= len(list) {
+				return nil, false, fmt.Errorf("unterminated string in list: %s", list)
+			}
+			v = listValue{text: b.String(), quoted: true}
+			list = strings.TrimSpace(list[i+1:])
+		} else {
+			end := strings.IndexByte(list, ',')
+			if end == -1 {
+				end = len(list)
+			}
+			v = listValue{text: strings.ReplaceAll(strings.TrimSpace(list[:end]), "''", "'")}
+			list = list[end:]
+		}
+
+		if list != "" {
+			if list[0] != ',' {
+				return nil, false, fmt.Errorf("expected comma in list: %s", list)
+			}
+			list = strings.TrimSpace(list[1:])
+		}
+		if v.text == allValue {
+			all = true
+			continue
+		}
+		values = append(values, v)
+	}
+	return values, all, nil
+}
+
+// macroIn filters a column by the values of a multi-value template variable,
+// as in `$__in(host, $host)`. Selecting "All" omits the filter and selecting
+// nothing filters out every row.
+func macroIn(query *sqlutil.Query, args []string) (string, error) {
+	if len(args) < 1 || args[0] == "" {
+		return "", fmt.Errorf("%w: expected at least 1 argument, received %d", sqlutil.ErrorBadArgumentCount, len(args))
+	}
+	values, all, err := parseListValues(args[1:])
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case all:
+		return "1 = 1", nil
+	case len(values) == 0:
+		return "1 = 0", nil
+	}
+
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = v.literal(false)
+	}
+	return fmt.Sprintf("%s in (%s)", args[0], strings.Join(literals, ", ")), nil
+}
+
+// macroCSVQuoted expands the values of a multi-value template variable into a
+// comma separated list of SQL strings, as in `host in ($__csvQuoted($host))`.
+// Selecting nothing expands to NULL, which matches no rows. "All" cannot be
+// expanded since its values are not known to the backend.
+func macroCSVQuoted(query *sqlutil.Query, args []string) (string, error) {
+	values, all, err := parseListValues(args)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case all:
+		return "", fmt.Errorf("cannot expand the All value of a variable, use $__in instead")
+	case len(values) == 0:
+		return "NULL", nil
+	}
+
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = v.literal(true)
+	}
+	return strings.Join(literals, ", "), nil
+}
+
+// quoteIdentifier quotes an identifier such as a column name for use in SQL
+// with the identifier quote of the server, or the default quote if it is
+// empty.
+func quoteIdentifier(name, quote string) string {
+	if quote == "" {
+		quote = defaultIdentifierQuote
+	}
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote
 }
 
 func macroTimeGroup(query *sqlutil.Query, args []string) (string, error) {
@@ -1,6 +1,11 @@
 package flightsql
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -73,3 +78,155 @@ func TestMacros(t *testing.T) {
 		})
 	}
 }
+
+func TestListMacros(t *testing.T) {
+	cs := []struct {
+		in  string
+		out string
+	}{
+		{
+			in:  `select * from x where $__in(host, 'a','b')`,
+			out: `select * from x where host in ('a', 'b')`,
+		},
+		{
+			in:  `select * from x where $__in(host, 'it''s', 'a, (b)')`,
+			out: `select * from x where host in ('it''s', 'a, (b)')`,
+		},
+		{
+			in:  `select * from x where $__in(lower(host), it''s)`,
+			out: `select * from x where lower(host) in ('it''s')`,
+		},
+		{
+			in:  `select * from x where $__in(id, 1,2.5) and $__in(host, '1')`,
+			out: `select * from x where id in (1, 2.5) and host in ('1')`,
+		},
+		{
+			in:  `select * from x where $__in(id, -1.5e3, NaN, Inf, 0x1p-2, 1.)`,
+			out: `select * from x where id in (-1.5e3, 'NaN', 'Inf', '0x1p-2', '1.')`,
+		},
+		{
+			in:  `select * from x where $__in(host, '$__all')`,
+			out: `select * from x where 1 = 1`,
+		},
+		{
+			in:  `select * from x where $__in(host, $__all)`,
+			out: `select * from x where 1 = 1`,
+		},
+		{
+			in:  `select * from x where $__in(host, )`,
+			out: `select * from x where 1 = 0`,
+		},
+		{
+			in:  `select * from x where $__in(host)`,
+			out: `select * from x where 1 = 0`,
+		},
+		{
+			in:  `select * from x where host in ($__csvQuoted('a','b'))`,
+			out: `select * from x where host in ('a', 'b')`,
+		},
+		{
+			in:  `select * from x where id in ($__csvQuoted(1, 2))`,
+			out: `select * from x where id in ('1', '2')`,
+		},
+		{
+			in:  `select * from x where host in ($__csvQuoted())`,
+			out: `select * from x where host in (NULL)`,
+		},
+	}
+	for _, c := range cs {
+		t.Run(c.in, func(t *testing.T) {
+			sql, err := expandListMacros(&sqlutil.Query{RawSQL: c.in}, macros)
+			require.NoError(t, err)
+			require.Equal(t, c.out, sql)
+		})
+	}
+
+	for in, msg := range map[string]string{
+		`select $__in(host, 'a'`:                 "unterminated $__in macro",
+		`select $__in(host, 'a)`:                 "unterminated $__in macro",
+		`select $__in(host, 'a' 'b')`:            "expected comma in list",
+		`select $__csvQuoted('$__all')`:          "cannot expand the All value",
+		`select $__in(, 'a')`:                    "unexpected number of arguments",
+		`select $__in(host, 'a') and $__in(host`: "unterminated $__in macro",
+	} {
+		_, err := expandListMacros(&sqlutil.Query{RawSQL: in}, macros)
+		require.ErrorContains(t, err, msg, in)
+	}
+
+	// List macros are expanded along with the other macros.
+	query, err := queryModel{Text: `select * from x where $__in(host, 'a') and $__timeFilter(time)`}.interpolate()
+	require.NoError(t, err)
+	require.Equal(t, `select * from x where host in ('a') and time >= '0001-01-01T00:00:00Z' AND time <= '0001-01-01T00:00:00Z'`, query.RawSQL)
+}
+
+func TestMacroRegistry(t *testing.T) {
+	names := map[string]bool{}
+	for _, def := range macroRegistry {
+		require.False(t, names[def.Name], "%s is registered twice", def.Name)
+		names[def.Name] = true
+
+		require.NotEmpty(t, def.Description, def.Name)
+		require.True(t, strings.HasPrefix(def.Signature, "$__"+def.Name), def.Name)
+		var args []string
+		if i := strings.IndexByte(def.Signature, '('); i != -1 {
+			args = strings.Split(strings.TrimSuffix(def.Signature[i+1:], ")"), ", ")
+		}
+		require.Len(t, def.Args, len(args), def.Name)
+		for i, arg := range def.Args {
+			require.Equal(t, args[i], arg.Name, def.Name)
+			require.NotEmpty(t, arg.Description, def.Name)
+		}
+
+		require.Regexp(t, `\$__`+def.Name+`\b`, def.Example, def.Name)
+		preview, err := def.preview()
+		require.NoError(t, err, def.Name)
+		require.NotContains(t, preview, "$__", def.Name)
+	}
+
+	for name := range macros {
+		require.True(t, names[name], "%s is not documented", name)
+	}
+	for name := range sqlutil.DefaultMacros {
+		require.True(t, names[name], "%s is not documented", name)
+	}
+	require.True(t, names["adhocFilters"])
+}
+
+func TestGetMacros(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&FlightSQLDatasource{}).getMacros(w, httptest.NewRequest(http.MethodGet, "/plugin/macros", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Macros []macroDoc `json:"macros"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	var names []string
+	for _, m := range resp.Macros {
+		names = append(names, m.Name)
+	}
+	require.Contains(t, names, "adhocFilters")
+	require.NotContains(t, names, "table")
+	require.NotContains(t, names, "column")
+	require.True(t, sort.SliceIsSorted(resp.Macros, func(i, j int) bool {
+		return resp.Macros[i].Name < resp.Macros[j].Name
+	}))
+
+	var in macroDoc
+	for _, m := range resp.Macros {
+		if m.Name == "in" {
+			in = m
+		}
+	}
+	require.Equal(t, macroDoc{
+		Name:        "in",
+		Signature:   "$__in(column, values)",
+		Description: "Filters the column by the values of a multi-value template variable. Selecting All omits the filter.",
+		Args: []macroArg{
+			{"column", "The column to filter."},
+			{"values", "The template variable, as in $host."},
+		},
+		Example: "select * from cpu where $__in(host, 'a','b')",
+		Preview: "select * from cpu where host in ('a', 'b')",
+	}, in)
+}
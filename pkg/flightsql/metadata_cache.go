@@ -0,0 +1,155 @@
+package flightsql
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	// defaultMetadataCacheTTL is how long metadata is cached when the
+	// datasource does not configure a TTL.
+	defaultMetadataCacheTTL = time.Minute
+	// metadataTimeout bounds the time taken to fetch metadata. Fetches are
+	// shared by concurrent requests, so they do not use the context of any of
+	// them.
+	metadataTimeout = 30 * time.Second
+)
+
+// metadataCache caches the metadata of the server such as its tables and
+// columns. Concurrent requests for the same metadata share a single fetch and
+// metadata requested during the last quarter of its TTL is refreshed in the
+// background so that it rarely has to be waited for.
+type metadataCache struct {
+	entries *lruCache[any]
+	// refreshBefore is the remaining lifetime of entries below which they
+	// are refreshed when requested.
+	refreshBefore time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*metadataCall
+	// generation is incremented by flush so that fetches started before are
+	// not stored.
+	generation int
+}
+
+// metadataCall is a fetch of metadata shared by concurrent requests.
+type metadataCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// newMetadataCache returns a [metadataCache] for the datasource configuration.
+func newMetadataCache(cfg config) *metadataCache {
+	ttl := time.Duration(cfg.MetadataCacheTTL)
+	if ttl <= 0 {
+		ttl = defaultMetadataCacheTTL
+	}
+	return &metadataCache{
+		entries:       newLRUCache(ttl, 0, 0, metadataRows),
+		refreshBefore: ttl / 4,
+		calls:         map[string]*metadataCall{},
+	}
+}
+
+// metadataRows returns the number of rows held by cached metadata.
+func metadataRows(v any) int {
+	switch v := v.(type) {
+	case backend.DataResponse:
+		return responseRows(v)
+	case []tableInfo:
+		return len(v)
+	default:
+		return 1
+	}
+}
+
+// loadMetadata returns the metadata cached under key, fetching it with fetch
+// if it is not cached.
+func loadMetadata[V any](ctx context.Context, c *metadataCache, key string, fetch func(context.Context) (V, error)) (V, error) {
+	v, err := c.load(ctx, key, func(ctx context.Context) (any, error) {
+		return fetch(ctx)
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return v.(V), nil
+}
+
+func (c *metadataCache) load(ctx context.Context, key string, fetch func(context.Context) (any, error)) (any, error) {
+	if v, expires, ok := c.entries.getWithExpiry(key); ok {
+		if expires.Sub(c.entries.now()) < c.refreshBefore {
+			go func() {
+				if _, err := c.wait(context.Background(), c.fetch(key, fetch)); err != nil {
+					logErrorf("Failed to refresh metadata: %s", err)
+				}
+			}()
+		}
+		return v, nil
+	}
+	return c.wait(ctx, c.fetch(key, fetch))
+}
+
+// fetch starts fetching the metadata for key unless it is already being
+// fetched and returns the fetch.
+func (c *metadataCache) fetch(key string, fetch func(context.Context) (any, error)) *metadataCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if call, ok := c.calls[key]; ok {
+		return call
+	}
+	call := &metadataCall{done: make(chan struct{})}
+	c.calls[key] = call
+	generation := c.generation
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+		defer cancel()
+		// The fetch does not run under the panic recovery of the resource
+		// handlers, so panics are recovered here and returned to the callers
+		// waiting for it.
+		defer func() {
+			if rec := recover(); rec != nil {
+				logErrorf("Panic: %s %s", rec, string(debug.Stack()))
+				call.value, call.err = nil, fmt.Errorf("fetch metadata: panic: %v", rec)
+			}
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if call.err == nil && generation == c.generation {
+				c.entries.set(key, call.value)
+			}
+			delete(c.calls, key)
+			close(call.done)
+		}()
+		call.value, call.err = fetch(ctx)
+	}()
+	return call
+}
+
+// wait waits for call to complete or ctx to be done.
+func (c *metadataCache) wait(ctx context.Context, call *metadataCall) (any, error) {
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush removes all cached metadata. Fetches in progress complete but their
+// results are not cached.
+func (c *metadataCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries.clear()
+}
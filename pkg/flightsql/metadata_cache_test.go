@@ -0,0 +1,190 @@
+package flightsql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow/flight"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataCache(t *testing.T) {
+	cache := newMetadataCache(config{MetadataCacheTTL: duration(time.Minute)})
+	var fetches int32
+	counted := func(context.Context) (string, error) {
+		atomic.AddInt32(&fetches, 1)
+		return "v", nil
+	}
+
+	v, err := loadMetadata(context.Background(), cache, "a", counted)
+	require.NoError(t, err)
+	require.Equal(t, "v", v)
+	_, err = loadMetadata(context.Background(), cache, "a", counted)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	cache.flush()
+	_, err = loadMetadata(context.Background(), cache, "a", counted)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	// Errors are not cached.
+	boom := errors.New("boom")
+	_, err = loadMetadata(context.Background(), cache, "b", func(context.Context) (string, error) {
+		return "", boom
+	})
+	require.ErrorIs(t, err, boom)
+	_, ok := cache.entries.get("b")
+	require.False(t, ok)
+}
+
+func TestMetadataCache_Panic(t *testing.T) {
+	cache := newMetadataCache(config{})
+
+	// Panics of fetches are returned as errors rather than crashing the
+	// plugin.
+	_, err := loadMetadata(context.Background(), cache, "a", func(context.Context) (string, error) {
+		var info *flight.FlightInfo
+		return info.Endpoint[0].Location[0].Uri, nil
+	})
+	require.ErrorContains(t, err, "fetch metadata: panic")
+	_, ok := cache.entries.get("a")
+	require.False(t, ok)
+
+	v, err := loadMetadata(context.Background(), cache, "a", func(context.Context) (string, error) {
+		return "v", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "v", v)
+}
+
+func TestEndpointTicket(t *testing.T) {
+	ticket := &flight.Ticket{Ticket: []byte("t")}
+	got, err := endpointTicket(&flight.FlightInfo{Endpoint: []*flight.FlightEndpoint{{Ticket: ticket}}})
+	require.NoError(t, err)
+	require.Equal(t, ticket, got)
+
+	_, err = endpointTicket(&flight.FlightInfo{})
+	require.EqualError(t, err, "unsupported endpoint count in response: 0")
+}
+
+func TestMetadataCache_Singleflight(t *testing.T) {
+	cache := newMetadataCache(config{})
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(context.Context) (string, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := loadMetadata(context.Background(), cache, "a", fetch)
+			require.NoError(t, err)
+			require.Equal(t, "v", v)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return cache.calls["a"] != nil
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// A request giving up does not cancel the fetch shared with others.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := loadMetadata(ctx, cache, "c", func(context.Context) (string, error) {
+		return "v", nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMetadataCache_FlushDuringFetch(t *testing.T) {
+	cache := newMetadataCache(config{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := loadMetadata(context.Background(), cache, "a", func(context.Context) (string, error) {
+			<-release
+			return "stale", nil
+		})
+		require.NoError(t, err)
+	}()
+	require.Eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return cache.calls["a"] != nil
+	}, time.Second, time.Millisecond)
+
+	cache.flush()
+	close(release)
+	<-done
+	_, ok := cache.entries.get("a")
+	require.False(t, ok)
+}
+
+func TestMetadataCache_Refresh(t *testing.T) {
+	cache := newMetadataCache(config{MetadataCacheTTL: duration(time.Minute)})
+	var now atomic.Value
+	start := time.Now()
+	now.Store(start)
+	cache.entries.now = func() time.Time { return now.Load().(time.Time) }
+
+	var value atomic.Value
+	value.Store("old")
+	fetch := func(context.Context) (string, error) {
+		return value.Load().(string), nil
+	}
+	_, err := loadMetadata(context.Background(), cache, "a", fetch)
+	require.NoError(t, err)
+
+	// Entries are refreshed in the background during the last quarter of
+	// their TTL and the cached value is returned meanwhile.
+	value.Store("new")
+	now.Store(start.Add(30 * time.Second))
+	v, _ := loadMetadata(context.Background(), cache, "a", fetch)
+	require.Equal(t, "old", v)
+
+	now.Store(start.Add(50 * time.Second))
+	v, _ = loadMetadata(context.Background(), cache, "a", fetch)
+	require.Equal(t, "old", v)
+	require.Eventually(t, func() bool {
+		v, _ := cache.entries.get("a")
+		return v == "new"
+	}, time.Second, time.Millisecond)
+}
+
+func TestIntegration_FlushCache(t *testing.T) {
+	ds := newTestDatasource(t, config{}, logsTable...)
+	tableNames := func() []string {
+		w := httptest.NewRecorder()
+		ds.getTables(w, httptest.NewRequest(http.MethodGet, "/flightsql/tables?pattern=log%25", nil))
+		frames := resourceFrames(t, w)
+		name, _ := frames[0].FieldByName("table_name")
+		return extractFieldValues[string](t, name)
+	}
+
+	require.Equal(t, []string{"logs"}, tableNames())
+	_, _, err := ds.queryFrame(context.Background(), "create table logs_archive (ts integer)")
+	require.NoError(t, err)
+	require.Equal(t, []string{"logs"}, tableNames())
+
+	w := httptest.NewRecorder()
+	ds.flushCache(w, httptest.NewRequest(http.MethodPost, "/flightsql/cache/flush", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.ElementsMatch(t, []string{"logs", "logs_archive"}, tableNames())
+}
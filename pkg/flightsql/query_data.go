@@ -3,12 +3,16 @@ package flightsql
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"runtime/debug"
 	"sync"
 	"time"
 
+	"github.com/apache/arrow/go/v12/arrow/flight"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
 	"google.golang.org/grpc/metadata"
 )
@@ -19,10 +23,18 @@ func (d *FlightSQLDatasource) QueryData(ctx context.Context, req *backend.QueryD
 		wg             sync.WaitGroup
 		response       = backend.NewQueryDataResponse()
 		executeResults = make(chan executeResult, len(req.Queries))
+		quoteOnce      sync.Once
+		quote          string
 	)
+	// The identifier quote is only looked up once and only if a query of the
+	// batch quotes identifiers.
+	identifierQuote := func() string {
+		quoteOnce.Do(func() { quote = d.identifierQuote(ctx) })
+		return quote
+	}
 
 	for _, dataQuery := range req.Queries {
-		query, err := decodeQueryRequest(dataQuery)
+		query, err := decodeQueryRequest(dataQuery, identifierQuote)
 		if err != nil {
 			response.Responses[dataQuery.RefID] = backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
 			continue
@@ -33,7 +45,7 @@ func (d *FlightSQLDatasource) QueryData(ctx context.Context, req *backend.QueryD
 			defer wg.Done()
 			executeResults <- executeResult{
 				refID:        query.RefID,
-				dataResponse: d.query(ctx, *query),
+				dataResponse: d.runQuery(ctx, *query),
 			}
 		}()
 	}
@@ -48,40 +60,293 @@ func (d *FlightSQLDatasource) QueryData(ctx context.Context, req *backend.QueryD
 }
 
 // decodeQueryRequest decodes a [backend.DataQuery] and returns a
-// [*sqlutil.Query] where all macros are expanded.
-func decodeQueryRequest(dataQuery backend.DataQuery) (*sqlutil.Query, error) {
+// [*queryModel] where all macros are expanded. Identifiers are quoted with the
+// identifier quote of the server returned by identifierQuote, which is only
+// called if the query quotes identifiers.
+func decodeQueryRequest(dataQuery backend.DataQuery, identifierQuote func() string) (*queryModel, error) {
 	var q queryRequest
 	if err := json.Unmarshal(dataQuery.JSON, &q); err != nil {
 		return nil, fmt.Errorf("unmarshal json: %w", err)
 	}
 
+	var timeUnit time.Duration
+	if q.TimeUnit != "" {
+		var ok bool
+		if timeUnit, ok = timeUnits[q.TimeUnit]; !ok {
+			return nil, fmt.Errorf("unsupported time unit: %q", q.TimeUnit)
+		}
+	}
+
+	var durationUnit time.Duration
+	if q.DurationUnit != "" {
+		var ok bool
+		if durationUnit, ok = timeUnits[q.DurationUnit]; !ok {
+			return nil, fmt.Errorf("unsupported duration unit: %q", q.DurationUnit)
+		}
+	}
+
+	fill, ok := fillModes[q.FillMode]
+	if !ok {
+		return nil, fmt.Errorf("unsupported fill mode: %q", q.FillMode)
+	}
+
+	duplicates, ok := duplicateModes[q.Duplicates]
+	if !ok {
+		return nil, fmt.Errorf("unsupported duplicates mode: %q", q.Duplicates)
+	}
+
+	if _, ok := variableSorts[q.VariableSort]; !ok {
+		return nil, fmt.Errorf("unsupported variable sort: %q", q.VariableSort)
+	}
+	var variableRegex *regexp.Regexp
+	if q.VariableRegex != "" {
+		var err error
+		if variableRegex, err = regexp.Compile(q.VariableRegex); err != nil {
+			return nil, fmt.Errorf("variable regex: %w", err)
+		}
+	}
+
+	quote := defaultIdentifierQuote
+	if quotesIdentifiers(q) {
+		quote = identifierQuote()
+	}
+	if _, err := adhocFiltersSQL(q.AdhocFilters, quote); err != nil {
+		return nil, err
+	}
+	// Ad-hoc filters are applied to the log lines of the supplementary logs
+	// queries, so the query is wrapped before them.
+	if q.WrapAdhocFilters {
+		var err error
+		if q.Text, err = wrapAdhocFilters(q.Text, q.AdhocFilters); err != nil {
+			return nil, err
+		}
+	}
+
+	text := q.Text
+	switch qt := queryType(q.QueryType); qt {
+	case queryTypeDefault, queryTypeVariable:
+	case queryTypeLogsVolume:
+		if q.Format != "logs" {
+			return nil, fmt.Errorf("logs volume queries require the logs format")
+		}
+		var err error
+		if text, err = logsVolumeSQL(q, dataQuery.TimeRange, quote); err != nil {
+			return nil, err
+		}
+	case queryTypeLogsContext:
+		var err error
+		if text, err = logsContextSQL(q, quote); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported query type: %q", q.QueryType)
+	}
+
 	var format sqlutil.FormatQueryOption
 	switch q.Format {
 	case "time_series":
 		format = sqlutil.FormatOptionTimeSeries
+	case "time_series_multi":
+		format = formatOptionTimeSeriesMulti
 	case "table":
 		format = sqlutil.FormatOptionTable
+	case "logs":
+		format = sqlutil.FormatOptionLogs
+	case "trace":
+		format = formatOptionTrace
+	case "node_graph":
+		format = formatOptionNodeGraph
 	default:
 		format = sqlutil.FormatOptionTimeSeries
 	}
+	// Variable queries return a table of text and value fields whatever
+	// their format.
+	if queryType(q.QueryType) == queryTypeVariable {
+		format = sqlutil.FormatOptionTable
+	}
+
+	query := queryModel{
+		Query: sqlutil.Query{
+			RawSQL:        text,
+			RefID:         q.RefID,
+			MaxDataPoints: q.MaxDataPoints,
+			Interval:      time.Duration(q.IntervalMilliseconds) * time.Millisecond,
+			TimeRange:     dataQuery.TimeRange,
+			Format:        format,
+		},
+		Text:           text,
+		NoCache:        q.NoCache,
+		Incremental:    q.Incremental,
+		ChunkInterval:  time.Duration(q.ChunkIntervalMilliseconds) * time.Millisecond,
+		FrameName:      q.FrameName,
+		LegendFormat:   q.LegendFormat,
+		FieldConfig:    q.FieldConfig,
+		TimeColumn:     q.TimeColumn,
+		TimeUnit:       timeUnit,
+		Fill:           fill,
+		FillValue:      q.FillValue,
+		Duplicates:     duplicates,
+		QueryType:      queryType(q.QueryType),
+		BodyColumn:     q.BodyColumn,
+		SeverityColumn: q.SeverityColumn,
+		LabelColumns:   q.LabelColumns,
+		DurationUnit:   durationUnit,
+		VariableRegex:  variableRegex,
+		VariableSort:   q.VariableSort,
+		AdhocFilters:   q.AdhocFilters,
 
-	query := &sqlutil.Query{
-		RawSQL:        q.Text,
-		RefID:         q.RefID,
-		MaxDataPoints: q.MaxDataPoints,
-		Interval:      time.Duration(q.IntervalMilliseconds) * time.Millisecond,
-		TimeRange:     dataQuery.TimeRange,
-		Format:        format,
+		IdentifierQuote: quote,
 	}
 
 	// Process macros and execute the query.
-	sql, err := sqlutil.Interpolate(query, macros)
+	query, err := query.interpolate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &query, nil
+}
+
+// quotesIdentifiers reports whether the SQL generated for q quotes
+// identifiers, that is if it has ad-hoc filters or is a supplementary logs
+// query.
+func quotesIdentifiers(q queryRequest) bool {
+	switch queryType(q.QueryType) {
+	case queryTypeLogsVolume, queryTypeLogsContext:
+		return true
+	}
+	return len(q.AdhocFilters) > 0 || q.WrapAdhocFilters
+}
+
+// queryModel is a decoded [queryRequest]. The embedded [sqlutil.Query] holds
+// the query text with all macros expanded.
+type queryModel struct {
+	sqlutil.Query
+
+	// Text is the query text before macro expansion.
+	Text string
+	// NoCache bypasses the query result cache of the datasource.
+	NoCache bool
+	// Incremental extends the results of the previous execution of a time
+	// series query by querying only the new tail of its time range.
+	Incremental bool
+	// ChunkInterval splits the time range of the query into chunks of the
+	// given duration that are queried concurrently.
+	ChunkInterval time.Duration
+	// FrameName is a template for the name of the result frame.
+	FrameName string
+	// LegendFormat is a template for the display names of the value fields.
+	LegendFormat string
+	// FieldConfig maps column names to display options for their fields.
+	FieldConfig map[string]fieldOptions
+	// TimeColumn names the time column of time series results. By default
+	// the first timestamp column is used.
+	TimeColumn string
+	// TimeUnit is the unit of a numeric time column.
+	TimeUnit time.Duration
+	// Fill is how missing values of time series results are filled.
+	Fill fillMode
+	// FillValue is the constant used by [fillModeValue].
+	FillValue float64
+	// Duplicates is how rows of a time series that share their time and
+	// labels are handled.
+	Duplicates duplicateMode
+	// QueryType selects a supplementary query of the format.
+	QueryType queryType
+	// BodyColumn names the body column of logs results. By default a column
+	// is detected by its name.
+	BodyColumn string
+	// SeverityColumn names the severity column of logs results. By default a
+	// column is detected by its name.
+	SeverityColumn string
+	// LabelColumns name the label columns of logs results. By default every
+	// other column is a label.
+	LabelColumns []string
+	// DurationUnit is the unit of the duration column of span results. By
+	// default durations are in milliseconds.
+	DurationUnit time.Duration
+	// VariableRegex filters the values of variable queries.
+	VariableRegex *regexp.Regexp
+	// VariableSort is the order of the values of variable queries. By default
+	// values are in the order of the results.
+	VariableSort string
+	// AdhocFilters are the ad-hoc filters expanded by the $__adhocFilters
+	// macro.
+	AdhocFilters []adhocFilter
+	// IdentifierQuote is the character the server quotes identifiers with.
+	IdentifierQuote string
+}
+
+// Formats supported in addition to those of [sqlutil.FormatQueryOption].
+const (
+	// formatOptionTrace formats span results for the trace view.
+	formatOptionTrace sqlutil.FormatQueryOption = sqlutil.FormatOptionLogs + 1 + iota
+	// formatOptionNodeGraph formats span results as the nodes and edges of a
+	// node graph.
+	formatOptionNodeGraph
+	// formatOptionTimeSeriesMulti formats time series results as one frame
+	// per series instead of a single wide frame.
+	formatOptionTimeSeriesMulti
+)
+
+// queryType selects a supplementary query of a format.
+type queryType string
+
+const (
+	// queryTypeDefault returns the results of the query in its format.
+	queryTypeDefault queryType = ""
+	// queryTypeLogsVolume returns the number of log lines of a logs query per
+	// interval and severity.
+	queryTypeLogsVolume queryType = "logs-volume"
+	// queryTypeLogsContext returns the log lines of a logs query right before
+	// or after a log line.
+	queryTypeLogsContext queryType = "logs-context"
+	// queryTypeVariable returns the values of a template variable.
+	queryTypeVariable queryType = "variable"
+)
+
+// withTimeRange returns a copy of the query with its macros expanded for the
+// time range tr.
+func (q queryModel) withTimeRange(tr backend.TimeRange) (queryModel, error) {
+	q.TimeRange = tr
+	return q.interpolate()
+}
+
+// interpolate returns a copy of the query with the macros in its text
+// expanded.
+func (q queryModel) interpolate() (queryModel, error) {
+	return q.interpolateMacros(macros)
+}
+
+// interpolateMacros returns a copy of the query with the macros in its text
+// expanded by the macros of m.
+func (q queryModel) interpolateMacros(m sqlutil.Macros) (queryModel, error) {
+	sql, err := expandListMacros(q.Query.WithSQL(q.Text), m)
+	if err != nil {
+		return q, fmt.Errorf("macro interpolation: %w", err)
+	}
+	sql, err = sqlutil.Interpolate(q.Query.WithSQL(sql), m)
+	if err != nil {
+		return q, fmt.Errorf("macro interpolation: %w", err)
+	}
+	// Ad-hoc filters are expanded last so that macros in their values are
+	// not expanded.
+	sql, err = expandAdhocFilters(sql, q.AdhocFilters, q.IdentifierQuote)
 	if err != nil {
-		return nil, fmt.Errorf("macro interpolation: %w", err)
+		return q, fmt.Errorf("macro interpolation: %w", err)
 	}
-	query.RawSQL = sql
+	q.RawSQL = sql
+	return q, nil
+}
 
-	return query, nil
+// endpointTicket returns the ticket of the single endpoint of a
+// [flight.FlightInfo]. Results spread over several endpoints are not
+// supported.
+func endpointTicket(info *flight.FlightInfo) (*flight.Ticket, error) {
+	if len(info.Endpoint) != 1 {
+		return nil, fmt.Errorf("unsupported endpoint count in response: %d", len(info.Endpoint))
+	}
+	return info.Endpoint[0].Ticket, nil
 }
 
 // executeResult is an envelope for concurrent query responses.
@@ -93,36 +358,107 @@ type executeResult struct {
 // queryRequest is an inbound query request as part of a batch of queries sent
 // to [(*FlightSQLDatasource).QueryData].
 type queryRequest struct {
-	RefID                string `json:"refId"`
-	Text                 string `json:"queryText"`
-	IntervalMilliseconds int    `json:"intervalMs"`
-	MaxDataPoints        int64  `json:"maxDataPoints"`
-	Format               string `json:"format"`
-}
-
-// query executes a SQL statement by issuing a `CommandStatementQuery` command to Flight SQL.
-func (d *FlightSQLDatasource) query(ctx context.Context, query sqlutil.Query) (resp backend.DataResponse) {
-	defer func() {
-		if r := recover(); r != nil {
-			logErrorf("Panic: %s %s", r, string(debug.Stack()))
-			resp = backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("panic: %s", r))
-		}
-	}()
+	RefID                     string                  `json:"refId"`
+	Text                      string                  `json:"queryText"`
+	IntervalMilliseconds      int                     `json:"intervalMs"`
+	MaxDataPoints             int64                   `json:"maxDataPoints"`
+	Format                    string                  `json:"format"`
+	NoCache                   bool                    `json:"noCache"`
+	Incremental               bool                    `json:"incremental"`
+	ChunkIntervalMilliseconds int64                   `json:"chunkIntervalMs"`
+	FrameName                 string                  `json:"frameName"`
+	LegendFormat              string                  `json:"legendFormat"`
+	FieldConfig               map[string]fieldOptions `json:"fieldConfig"`
+	TimeColumn                string                  `json:"timeColumn"`
+	TimeUnit                  string                  `json:"timeUnit"`
+	FillMode                  string                  `json:"fillMode"`
+	FillValue                 float64                 `json:"fillValue"`
+	Duplicates                string                  `json:"duplicates"`
+	QueryType                 string                  `json:"queryType"`
+	BodyColumn                string                  `json:"bodyColumn"`
+	SeverityColumn            string                  `json:"severityColumn"`
+	LabelColumns              []string                `json:"labelColumns"`
+	ContextTimeMilliseconds   int64                   `json:"contextTimeMs"`
+	ContextTimeNanoseconds    int64                   `json:"contextTimeNs"`
+	ContextDirection          string                  `json:"contextDirection"`
+	ContextLimit              int                     `json:"contextLimit"`
+	DurationUnit              string                  `json:"durationUnit"`
+	VariableRegex             string                  `json:"variableRegex"`
+	VariableSort              string                  `json:"variableSort"`
+	AdhocFilters              []adhocFilter           `json:"adhocFilters"`
+	WrapAdhocFilters          bool                    `json:"wrapAdhocFilters"`
+}
+
+// runQuery executes a decoded query using the execution strategy it opted
+// into.
+func (d *FlightSQLDatasource) runQuery(ctx context.Context, query queryModel) backend.DataResponse {
+	if query.Incremental {
+		return d.incrementalQuery(ctx, query)
+	}
+	return d.cachedQuery(ctx, query)
+}
+
+// query executes the query and formats its results. Queries consisting of
+// several statements return one frame per statement.
+func (d *FlightSQLDatasource) query(ctx context.Context, query queryModel) (resp backend.DataResponse) {
+	defer recoverDataResponse(&resp)
 
+	if statements := splitStatements(query.Text); len(statements) > 1 {
+		return d.queryStatements(ctx, query, statements)
+	}
+	return d.queryStatement(ctx, query)
+}
+
+// queryStatement executes a query consisting of a single statement and formats
+// its results.
+func (d *FlightSQLDatasource) queryStatement(ctx context.Context, query queryModel) backend.DataResponse {
+	frame, headers, err := d.queryResults(ctx, query)
+	if frame == nil {
+		return backend.ErrDataResponse(errorStatus(err), err.Error())
+	}
+	return frameDataResponse(frame, err, query, headers)
+}
+
+// errorStatus returns the status of the response to a query that failed with
+// err. Errors caused by the options of the query are bad requests.
+func errorStatus(err error) backend.Status {
+	if errors.Is(err, errTooManyChunks) {
+		return backend.StatusBadRequest
+	}
+	return backend.StatusInternal
+}
+
+// recoverDataResponse replaces *resp with an error response if the calling
+// function panics. It must be deferred.
+func recoverDataResponse(resp *backend.DataResponse) {
+	if r := recover(); r != nil {
+		logErrorf("Panic: %s %s", r, string(debug.Stack()))
+		*resp = backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("panic: %s", r))
+	}
+}
+
+// queryFrame executes a SQL statement by issuing a `CommandStatementQuery`
+// command to Flight SQL and reads the results into a single frame.
+//
+// A nil frame is returned if the statement could not be executed. Errors that
+// occur while reading the results are returned along with the rows read so
+// far.
+func (d *FlightSQLDatasource) queryFrame(ctx context.Context, sql string) (*data.Frame, metadata.MD, error) {
 	if d.md.Len() != 0 {
 		ctx = metadata.NewOutgoingContext(ctx, d.md)
 	}
 
-	info, err := d.client.Execute(ctx, query.RawSQL)
+	info, err := d.client.Execute(ctx, sql)
 	if err != nil {
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("flightsql: %s", err))
+		return nil, nil, fmt.Errorf("flightsql: %s", err)
 	}
-	if len(info.Endpoint) != 1 {
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("unsupported endpoint count in response: %d", len(info.Endpoint)))
+	ticket, err := endpointTicket(info)
+	if err != nil {
+		return nil, nil, err
 	}
-	reader, err := d.client.DoGetWithHeaderExtraction(ctx, info.Endpoint[0].Ticket)
+	reader, err := d.client.DoGetWithHeaderExtraction(ctx, ticket)
 	if err != nil {
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("flightsql: %s", err))
+		return nil, nil, fmt.Errorf("flightsql: %s", err)
 	}
 	defer reader.Release()
 
@@ -131,5 +467,6 @@ func (d *FlightSQLDatasource) query(ctx context.Context, query sqlutil.Query) (r
 		logErrorf("Failed to extract headers: %s", err)
 	}
 
-	return newQueryDataResponse(reader, query, headers)
+	frame, err := frameForRecords(reader)
+	return frame, headers, err
 }
@@ -4,40 +4,69 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/apache/arrow/go/v12/arrow"
 	"github.com/apache/arrow/go/v12/arrow/array"
 	"github.com/apache/arrow/go/v12/arrow/flight"
 	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
 	"github.com/apache/arrow/go/v12/arrow/memory"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
-	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"google.golang.org/grpc/metadata"
 )
 
+// macroDoc is the documentation of a macro served from /plugin/macros.
+type macroDoc struct {
+	Name        string     `json:"name"`
+	Signature   string     `json:"signature"`
+	Description string     `json:"description"`
+	Args        []macroArg `json:"args"`
+	Example     string     `json:"example"`
+	// Preview is the expansion of the example.
+	Preview string `json:"preview"`
+}
+
+// getMacros documents the registered macros that are not hidden, sorted by
+// name.
 func (d *FlightSQLDatasource) getMacros(w http.ResponseWriter, r *http.Request) {
-	size := len(sqlutil.DefaultMacros) + len(macros)
-	names := make([]string, 0, size)
-	for k := range sqlutil.DefaultMacros {
-		if k == "table" || k == "column" {
-			// We don't have the information available for these to function
-			// propperly so omit them from advertisement.
+	docs := make([]macroDoc, 0, len(macroRegistry))
+	for _, def := range macroRegistry {
+		if def.Hidden {
 			continue
 		}
-		names = append(names, k)
-	}
-	for k := range macros {
-		names = append(names, k)
+		preview, err := def.preview()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("$__%s: %s", def.Name, err), http.StatusInternalServerError)
+			return
+		}
+		args := def.Args
+		if args == nil {
+			args = []macroArg{}
+		}
+		docs = append(docs, macroDoc{
+			Name:        def.Name,
+			Signature:   def.Signature,
+			Description: def.Description,
+			Args:        args,
+			Example:     def.Example,
+			Preview:     preview,
+		})
 	}
-	sort.Strings(names)
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
 
 	err := json.NewEncoder(w).Encode(struct {
-		Macros []string `json:"macros"`
+		Macros []macroDoc `json:"macros"`
 	}{
-		Macros: names,
+		Macros: docs,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -45,110 +74,420 @@ func (d *FlightSQLDatasource) getMacros(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (d *FlightSQLDatasource) getSQLInfo(w http.ResponseWriter, r *http.Request) {
+// getCatalogs lists the catalogs of the server.
+func (d *FlightSQLDatasource) getCatalogs(w http.ResponseWriter, r *http.Request) {
+	d.writeMetadata(w, r, func(ctx context.Context) (*flight.FlightInfo, error) {
+		return d.client.GetCatalogs(ctx)
+	})
+}
+
+// getSchemas lists the schemas of the server, optionally limited to the
+// catalog query parameter and to the schemas matching the pattern query
+// parameter.
+func (d *FlightSQLDatasource) getSchemas(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	d.writeMetadata(w, r, func(ctx context.Context) (*flight.FlightInfo, error) {
+		return d.client.GetDBSchemas(ctx, &flightsql.GetDBSchemasOpts{
+			Catalog:               paramOrDefault(params, "catalog", d.defaultCatalog),
+			DbSchemaFilterPattern: optionalParam(params, "pattern"),
+		})
+	})
+}
+
+// getTableTypes lists the table types of the server.
+func (d *FlightSQLDatasource) getTableTypes(w http.ResponseWriter, r *http.Request) {
+	d.writeMetadata(w, r, func(ctx context.Context) (*flight.FlightInfo, error) {
+		return d.client.GetTableTypes(ctx)
+	})
+}
+
+// getTables lists the tables of the configured types, optionally limited to
+// the catalog and schema query parameters and to the tables matching the
+// pattern query parameter.
+func (d *FlightSQLDatasource) getTables(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	opts := d.tablesOpts(params)
+	opts.TableNameFilterPattern = optionalParam(params, "pattern")
+	d.writeMetadata(w, r, func(ctx context.Context) (*flight.FlightInfo, error) {
+		return d.client.GetTables(ctx, opts)
+	})
+}
+
+// getColumns describes the columns of the table named by the table query
+// parameter, optionally limited to the columns matching the pattern query
+// parameter. The table is looked up by its exact name in the catalog and schema
+// named by the query parameters or the default catalog and schema. If more
+// than one table matches, the candidates are returned with a conflict status.
+func (d *FlightSQLDatasource) getColumns(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	tableName := params.Get("table")
+	if tableName == "" {
+		http.Error(w, `query parameter "table" is required`, http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
-	ctx = metadata.NewOutgoingContext(ctx, d.md)
-	info, err := d.client.GetSqlInfo(ctx, []flightsql.SqlInfo{})
+	tables, err := d.findTables(ctx, params, tableName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	reader, err := d.client.DoGet(ctx, info.Endpoint[0].Ticket)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !requireSingleTable(w, tableName, tables) {
+		return
+	}
+	schema := tables[0].Columns
+	if schema == nil {
+		http.Error(w, "table_schema field not found", http.StatusInternalServerError)
 		return
 	}
-	defer reader.Release()
 
-	if err := writeDataResponse(w, newDataResponse(reader)); err != nil {
+	var re *regexp.Regexp
+	if pattern := params.Get("pattern"); pattern != "" {
+		re = likePattern(pattern)
+	}
+	var resp backend.DataResponse
+	resp.Frames = data.Frames{columnsFrame(schema, re)}
+	if err := writeDataResponse(w, resp); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func (d *FlightSQLDatasource) getTables(w http.ResponseWriter, r *http.Request) {
+// remarksKey is the metadata key of the remarks of a column, which the
+// version of Flight SQL in use does not define.
+const remarksKey = "ARROW:FLIGHT:SQL:REMARKS"
+
+// columnsFrame returns a frame with one row per column of schema matching re,
+// or every column if re is nil, holding its name, Arrow type, nullability and
+// the type name, precision, scale and remarks of its Flight SQL column
+// metadata.
+func columnsFrame(schema *arrow.Schema, re *regexp.Regexp) *data.Frame {
+	frame := data.NewFrame("columns",
+		data.NewField("name", nil, []string{}),
+		data.NewField("type", nil, []string{}),
+		data.NewField("nullable", nil, []bool{}),
+		data.NewField("type_name", nil, []*string{}),
+		data.NewField("precision", nil, []*int32{}),
+		data.NewField("scale", nil, []*int32{}),
+		data.NewField("remarks", nil, []*string{}),
+	)
+	for _, f := range schema.Fields() {
+		if re != nil && !re.MatchString(f.Name) {
+			continue
+		}
+		frame.AppendRow(
+			f.Name,
+			f.Type.String(),
+			f.Nullable,
+			columnMetadata(f, flightsql.TypeNameKey),
+			columnMetadataInt(f, flightsql.PrecisionKey),
+			columnMetadataInt(f, flightsql.ScaleKey),
+			columnMetadata(f, remarksKey),
+		)
+	}
+	return frame
+}
+
+// columnMetadata returns the value of a metadata key of a column, or nil if it
+// is not set. The metadata is read directly because [flightsql.ColumnMetadata]
+// looks up the catalog name for every key.
+func columnMetadata(f arrow.Field, key string) *string {
+	if i := f.Metadata.FindKey(key); i != -1 {
+		v := f.Metadata.Values()[i]
+		return &v
+	}
+	return nil
+}
+
+// columnMetadataInt returns the integer value of a metadata key of a column, or
+// nil if it is not set or not an integer.
+func columnMetadataInt(f arrow.Field, key string) *int32 {
+	s := columnMetadata(f, key)
+	if s == nil {
+		return nil
+	}
+	v, err := strconv.ParseInt(*s, 10, 32)
+	if err != nil {
+		return nil
+	}
+	n := int32(v)
+	return &n
+}
+
+// writeMetadata writes the results of the metadata request made by get as a
+// data response. The results are cached under the path and query parameters of
+// r.
+func (d *FlightSQLDatasource) writeMetadata(w http.ResponseWriter, r *http.Request, get func(context.Context) (*flight.FlightInfo, error)) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
-	ctx = metadata.NewOutgoingContext(ctx, d.md)
 
-	info, err := d.client.GetTables(ctx, &flightsql.GetTablesOpts{
-		TableTypes: []string{"BASE TABLE", "table"},
+	key := "resource:" + r.URL.Path + "?" + r.URL.Query().Encode()
+	resp, err := loadMetadata(ctx, d.metadata, key, func(ctx context.Context) (backend.DataResponse, error) {
+		ctx = metadata.NewOutgoingContext(ctx, d.md)
+		info, err := get(ctx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		ticket, err := endpointTicket(info)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		reader, err := d.client.DoGet(ctx, ticket)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		defer reader.Release()
+
+		resp := newDataResponse(reader)
+		return resp, resp.Error
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	reader, err := d.client.DoGet(ctx, info.Endpoint[0].Ticket)
-	if err != nil {
+	if err := writeDataResponse(w, resp); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer reader.Release()
+}
 
-	if err := writeDataResponse(w, newDataResponse(reader)); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// flushCache removes all cached metadata and ad-hoc filter suggestions.
+func (d *FlightSQLDatasource) flushCache(w http.ResponseWriter, r *http.Request) {
+	d.metadata.flush()
+	d.tags.clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// optionalParam returns the value of a query parameter or nil if it is empty.
+func optionalParam(params url.Values, name string) *string {
+	if v := params.Get(name); v != "" {
+		return &v
 	}
+	return nil
 }
 
-func (d *FlightSQLDatasource) getColumns(w http.ResponseWriter, r *http.Request) {
-	tableName := r.URL.Query().Get("table")
-	if tableName == "" {
-		http.Error(w, `query parameter "table" is required`, http.StatusBadRequest)
-		return
+// findTables returns the tables named name, or all tables if name is empty, in
+// the catalog and schema named by the query parameters or the default catalog
+// and schema. Names are matched exactly: pattern characters are escaped with
+// the search string escape of the server and, since servers without one match
+// them as patterns, the results are filtered again.
+func (d *FlightSQLDatasource) findTables(ctx context.Context, params url.Values, name string) ([]tableInfo, error) {
+	escape, err := d.sqlInfoString(ctx, flightsql.SqlInfoSearchStringEscape)
+	if err != nil {
+		logErrorf("Failed to get search string escape: %s", err)
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
-	ctx = metadata.NewOutgoingContext(ctx, d.md)
-	info, err := d.client.GetTables(ctx, &flightsql.GetTablesOpts{
-		TableNameFilterPattern: &tableName,
-		IncludeSchema:          true,
+	opts := d.tablesOpts(params)
+	opts.IncludeSchema = true
+	schema := opts.DbSchemaFilterPattern
+	if schema != nil {
+		pattern := escapePattern(*schema, escape)
+		opts.DbSchemaFilterPattern = &pattern
+	}
+	if name != "" {
+		pattern := escapePattern(name, escape)
+		opts.TableNameFilterPattern = &pattern
+	}
+	key := fmt.Sprintf("tables:%s:%s:%s", stringOrNil(opts.Catalog), stringOrNil(opts.DbSchemaFilterPattern), name)
+	tables, err := loadMetadata(ctx, d.metadata, key, func(ctx context.Context) ([]tableInfo, error) {
+		return d.getTableInfos(ctx, opts)
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	reader, err := d.client.DoGet(ctx, info.Endpoint[0].Ticket)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+
+	var found []tableInfo
+	for _, t := range tables {
+		if name != "" && t.Name != name {
+			continue
+		}
+		if (opts.Catalog != nil && t.Catalog != *opts.Catalog) || (schema != nil && t.Schema != *schema) {
+			continue
+		}
+		found = append(found, t)
 	}
-	defer reader.Release()
+	return found, nil
+}
 
-	if !reader.Next() {
-		http.Error(w, "table not found", http.StatusNotFound)
-		return
+// requireSingleTable reports whether tables holds exactly one table. If not, it
+// responds that the table named name was not found or, if more than one table
+// has that name, that it is ambiguous with the candidates as JSON.
+func requireSingleTable(w http.ResponseWriter, name string, tables []tableInfo) bool {
+	switch len(tables) {
+	case 0:
+		http.Error(w, fmt.Sprintf("table %q not found", name), http.StatusNotFound)
+		return false
+	case 1:
+		return true
 	}
-	rec := reader.Record()
-	rec.Retain()
-	defer rec.Release()
-	reader.Next()
-	if err := reader.Err(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+
+	resp := struct {
+		Error      string     `json:"error"`
+		Candidates []tableRef `json:"candidates"`
+	}{Error: fmt.Sprintf("table %q is ambiguous", name)}
+	for _, t := range tables {
+		resp.Candidates = append(resp.Candidates, t.tableRef)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logErrorf("Failed to write response: %s", err)
+	}
+	return false
+}
 
-	indices := rec.Schema().FieldIndices("table_schema")
-	if len(indices) == 0 {
-		http.Error(w, "table_schema field not found", http.StatusInternalServerError)
-		return
+// escapePattern escapes the characters of s that are special in the patterns
+// of metadata requests with the search string escape of the server. s is
+// returned as is if the server has no escape.
+func escapePattern(s, escape string) string {
+	if escape == "" {
+		return s
+	}
+	return strings.NewReplacer(escape, escape+escape, "%", escape+"%", "_", escape+"_").Replace(s)
+}
+
+// stringOrNil returns *s, or "<nil>" if s is nil.
+func stringOrNil(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+// paramOrDefault returns the value of a query parameter, or def if it is
+// empty, or nil if both are empty.
+func paramOrDefault(params url.Values, name, def string) *string {
+	if v := optionalParam(params, name); v != nil {
+		return v
+	}
+	if def != "" {
+		return &def
+	}
+	return nil
+}
+
+// tablesOpts returns the options listing the tables of the configured types
+// in the catalog and schema named by the query parameters or, if they name
+// none, the default catalog and schema.
+func (d *FlightSQLDatasource) tablesOpts(params url.Values) *flightsql.GetTablesOpts {
+	return &flightsql.GetTablesOpts{
+		Catalog:               paramOrDefault(params, "catalog", d.defaultCatalog),
+		DbSchemaFilterPattern: paramOrDefault(params, "schema", d.defaultSchema),
+		TableTypes:            d.tableTypes,
 	}
-	col := rec.Column(indices[0])
-	serializedSchema := array.NewStringData(col.Data()).Value(0)
-	schema, err := flight.DeserializeSchema([]byte(serializedSchema), memory.DefaultAllocator)
+}
+
+// likePattern returns a regular expression matching the same strings as a
+// SQL LIKE pattern, in which % matches any sequence of characters and _ any
+// single character.
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// tableRef identifies a table by its catalog, schema and name.
+type tableRef struct {
+	Catalog string `json:"catalog"`
+	Schema  string `json:"schema"`
+	Name    string `json:"name"`
+}
+
+// tableInfo describes a table returned by GetTables.
+type tableInfo struct {
+	tableRef
+	Type string `json:"type"`
+	// Columns is the schema of the table if it was requested.
+	Columns *arrow.Schema `json:"-"`
+}
+
+// getTableInfos returns the tables matching opts. All records of the results
+// are read.
+func (d *FlightSQLDatasource) getTableInfos(ctx context.Context, opts *flightsql.GetTablesOpts) ([]tableInfo, error) {
+	ctx = metadata.NewOutgoingContext(ctx, d.md)
+	info, err := d.client.GetTables(ctx, opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	ticket, err := endpointTicket(info)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := d.client.DoGet(ctx, ticket)
+	if err != nil {
+		return nil, err
 	}
+	defer reader.Release()
 
-	var resp backend.DataResponse
-	resp.Frames = append(resp.Frames, newFrame(schema))
-	if err := writeDataResponse(w, resp); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	var tables []tableInfo
+	for reader.Next() {
+		rec := reader.Record()
+		column := func(name string) arrow.Array {
+			if indices := rec.Schema().FieldIndices(name); len(indices) > 0 {
+				return rec.Column(indices[0])
+			}
+			return nil
+		}
+		var (
+			catalogs = column("catalog_name")
+			schemas  = column("db_schema_name")
+			names    = column("table_name")
+			types    = column("table_type")
+			columns  = column("table_schema")
+		)
+		if names == nil {
+			return nil, fmt.Errorf("table_name field not found")
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			table := tableInfo{
+				tableRef: tableRef{
+					Catalog: arrayString(catalogs, i),
+					Schema:  arrayString(schemas, i),
+					Name:    arrayString(names, i),
+				},
+				Type: arrayString(types, i),
+			}
+			if columns != nil {
+				table.Columns, err = flight.DeserializeSchema([]byte(arrayString(columns, i)), memory.DefaultAllocator)
+				if err != nil {
+					return nil, fmt.Errorf("table_schema of %s: %w", table.Name, err)
+				}
+			}
+			tables = append(tables, table)
+		}
+	}
+	if err := reader.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// arrayString returns the value of a string or binary array at row i as a
+// string. Null values, missing arrays and arrays of other types are empty
+// strings.
+func arrayString(arr arrow.Array, i int) string {
+	if arr == nil || arr.IsNull(i) {
+		return ""
+	}
+	switch arr := arr.(type) {
+	case *array.String:
+		return arr.Value(i)
+	case *array.Binary:
+		return string(arr.Value(i))
 	}
+	return ""
 }
 
 func newDataResponse(reader recordReader) backend.DataResponse {
@@ -0,0 +1,168 @@
+package flightsql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLikePattern(t *testing.T) {
+	re := likePattern("ts_%.x")
+	require.True(t, re.MatchString("ts_a.x"))
+	require.True(t, re.MatchString("tsb.x"))
+	require.False(t, re.MatchString("ts_ayx"))
+	require.False(t, re.MatchString("ts.x"))
+}
+
+func TestIntegration_Resources(t *testing.T) {
+	ds := newTestDatasource(t, config{}, logsTable...)
+
+	get := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	frames := resourceFrames(t, get(ds.getCatalogs, "/flightsql/catalogs"))
+	require.Equal(t, []string{"main"}, extractFieldValues[string](t, frames[0].Fields[0]))
+
+	frames = resourceFrames(t, get(ds.getSchemas, "/flightsql/schemas?catalog=main"))
+	require.Equal(t, 1, frames[0].Rows())
+
+	frames = resourceFrames(t, get(ds.getTables, "/flightsql/tables?catalog=main&pattern=lo%25"))
+	name, _ := frames[0].FieldByName("table_name")
+	require.Equal(t, []string{"logs"}, extractFieldValues[string](t, name))
+
+	frames = resourceFrames(t, get(ds.getTables, "/flightsql/tables?pattern=missing"))
+	require.Equal(t, 0, frames[0].Rows())
+
+	frames = resourceFrames(t, get(ds.getColumns, "/flightsql/columns?table=logs&pattern=%25e"))
+	require.Equal(t, []string{"message", "service"}, extractFieldValues[string](t, frames[0].Fields[0]))
+}
+
+func TestIntegration_Resources_Columns(t *testing.T) {
+	ds := newTestDatasource(t, config{}, append(append([]string{}, logsTable...), `create table lo_s (id integer, value real)`)...)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ds.getColumns(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// The underscore does not match logs.
+	frames := resourceFrames(t, get("/flightsql/columns?table=lo_s&catalog=main"))
+	frame := frames[0]
+	require.Equal(t, []string{"id", "value"}, extractFieldValues[string](t, frame.Fields[0]))
+	require.Equal(t, []string{"int64", "float64"}, extractFieldValues[string](t, frame.Fields[1]))
+	require.Equal(t, "precision", frame.Fields[4].Name)
+	require.Equal(t, []*int32{ptr[int32](10), ptr[int32](15)}, extractFieldValues[*int32](t, frame.Fields[4]))
+
+	require.Equal(t, http.StatusNotFound, get("/flightsql/columns?table=lo%25").Code)
+	require.Equal(t, http.StatusNotFound, get("/flightsql/columns?table=logs&catalog=other").Code)
+	require.Equal(t, http.StatusBadRequest, get("/flightsql/columns").Code)
+}
+
+func TestEscapePattern(t *testing.T) {
+	require.Equal(t, "a_b%", escapePattern("a_b%", ""))
+	require.Equal(t, `a\_b\\\%`, escapePattern(`a_b\%`, `\`))
+	require.Equal(t, "a!_b!!c", escapePattern("a_b!c", "!"))
+}
+
+func TestRequireSingleTable(t *testing.T) {
+	logs := tableInfo{tableRef: tableRef{Catalog: "main", Schema: "a", Name: "logs"}}
+
+	w := httptest.NewRecorder()
+	require.True(t, requireSingleTable(w, "logs", []tableInfo{logs}))
+
+	w = httptest.NewRecorder()
+	require.False(t, requireSingleTable(w, "logs", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	other := logs
+	other.Schema = "b"
+	w = httptest.NewRecorder()
+	require.False(t, requireSingleTable(w, "logs", []tableInfo{logs, other}))
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.JSONEq(t, `{
+		"error": "table \"logs\" is ambiguous",
+		"candidates": [
+			{"catalog": "main", "schema": "a", "name": "logs"},
+			{"catalog": "main", "schema": "b", "name": "logs"}
+		]
+	}`, w.Body.String())
+}
+
+func TestColumnsFrame(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "price", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}, Nullable: true, Metadata: arrow.NewMetadata(
+			[]string{flightsql.TypeNameKey, flightsql.PrecisionKey, flightsql.ScaleKey, remarksKey},
+			[]string{"DECIMAL", "10", "2", "unit price"},
+		)},
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	frame := columnsFrame(schema, nil)
+	require.Equal(t, []string{"price", "id"}, extractFieldValues[string](t, frame.Fields[0]))
+	require.Equal(t, []string{"decimal(10, 2)", "int64"}, extractFieldValues[string](t, frame.Fields[1]))
+	require.Equal(t, []bool{true, false}, extractFieldValues[bool](t, frame.Fields[2]))
+	require.Equal(t, []*string{ptr("DECIMAL"), nil}, extractFieldValues[*string](t, frame.Fields[3]))
+	require.Equal(t, []*int32{ptr[int32](10), nil}, extractFieldValues[*int32](t, frame.Fields[4]))
+	require.Equal(t, []*int32{ptr[int32](2), nil}, extractFieldValues[*int32](t, frame.Fields[5]))
+	require.Equal(t, []*string{ptr("unit price"), nil}, extractFieldValues[*string](t, frame.Fields[6]))
+
+	frame = columnsFrame(schema, likePattern("i_"))
+	require.Equal(t, []string{"id"}, extractFieldValues[string](t, frame.Fields[0]))
+}
+
+func TestIntegration_Resources_TableTypes(t *testing.T) {
+	setup := append(append([]string{}, logsTable...), `create view errors as select * from logs where level = 'error'`)
+	ds := newTestDatasource(t, config{}, setup...)
+	tableNames := func() []string {
+		w := httptest.NewRecorder()
+		ds.getTables(w, httptest.NewRequest(http.MethodGet, "/flightsql/tables?pattern=%25o%25", nil))
+		frames := resourceFrames(t, w)
+		name, _ := frames[0].FieldByName("table_name")
+		return extractFieldValues[string](t, name)
+	}
+
+	// Views are not listed by default.
+	require.ElementsMatch(t, []string{"logs", "foreignTable"}, tableNames())
+
+	w := httptest.NewRecorder()
+	ds.getTableTypes(w, httptest.NewRequest(http.MethodGet, "/flightsql/table-types", nil))
+	frames := resourceFrames(t, w)
+	require.ElementsMatch(t, []string{"table", "view"}, extractFieldValues[string](t, frames[0].Fields[0]))
+
+	ds.tableTypes = []string{"view"}
+	ds.metadata.flush()
+	require.Equal(t, []string{"errors"}, tableNames())
+
+	ds.tableTypes = tableTypes([]string{"*"})
+	ds.metadata.flush()
+	require.ElementsMatch(t, []string{"logs", "errors", "foreignTable"}, tableNames())
+
+	ds.defaultCatalog = "other"
+	ds.metadata.flush()
+	require.Empty(t, tableNames())
+}
+
+func TestTableTypes(t *testing.T) {
+	require.Equal(t, defaultTableTypes, tableTypes(nil))
+	require.Equal(t, defaultTableTypes, tableTypes([]string{}))
+	require.Equal(t, []string{"view"}, tableTypes([]string{"view"}))
+	require.Nil(t, tableTypes([]string{"table", "*"}))
+}
+
+func TestSetSessionDefault(t *testing.T) {
+	md := metadata.Pairs("database", "configured")
+	setSessionDefault(md, "database", "default")
+	setSessionDefault(md, "schema", "public")
+	setSessionDefault(md, "", "ignored")
+	setSessionDefault(md, "catalog", "")
+	require.Equal(t, metadata.Pairs("database", "configured", "schema", "public"), md)
+}
@@ -0,0 +1,178 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+	"google.golang.org/grpc/metadata"
+)
+
+// defaultIdentifierQuote is the character identifiers are quoted with when the
+// server does not report one.
+const defaultIdentifierQuote = `"`
+
+// getSQLInfo writes the SqlInfo values reported by the server as a JSON object
+// keyed by their names in lower case, such as "flight_sql_server_name" or
+// "sql_keywords".
+func (d *FlightSQLDatasource) getSQLInfo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	infos, err := d.sqlInfo(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	named := make(map[string]any, len(infos))
+	for info, v := range infos {
+		named[strings.ToLower(info.String())] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(named); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// sqlInfo returns the SqlInfo values reported by the server. Values are
+// strings, bools, int64s, int32 bitmasks, lists of strings or maps of int32s to
+// lists of int32s.
+func (d *FlightSQLDatasource) sqlInfo(ctx context.Context) (map[flightsql.SqlInfo]any, error) {
+	return loadMetadata(ctx, d.metadata, "sql-info", d.fetchSQLInfo)
+}
+
+func (d *FlightSQLDatasource) fetchSQLInfo(ctx context.Context) (map[flightsql.SqlInfo]any, error) {
+	ctx = metadata.NewOutgoingContext(ctx, d.md)
+	info, err := d.client.GetSqlInfo(ctx, []flightsql.SqlInfo{})
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := endpointTicket(info)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := d.client.DoGet(ctx, ticket)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Release()
+
+	infos := map[flightsql.SqlInfo]any{}
+	for reader.Next() {
+		rec := reader.Record()
+		names, ok := rec.Column(0).(*array.Uint32)
+		if !ok {
+			return nil, fmt.Errorf("unexpected info_name type: %s", rec.Column(0).DataType())
+		}
+		values, ok := rec.Column(1).(*array.DenseUnion)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value type: %s", rec.Column(1).DataType())
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			v, err := sqlInfoValue(values.Field(values.ChildID(i)), int(values.ValueOffset(i)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", flightsql.SqlInfo(names.Value(i)), err)
+			}
+			infos[flightsql.SqlInfo(names.Value(i))] = v
+		}
+	}
+	if err := reader.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// sqlInfoValue decodes the value at index i of a child of the dense union
+// holding SqlInfo values.
+func sqlInfoValue(arr arrow.Array, i int) (any, error) {
+	if arr.IsNull(i) {
+		return nil, nil
+	}
+	switch arr := arr.(type) {
+	case *array.String:
+		return arr.Value(i), nil
+	case *array.Boolean:
+		return arr.Value(i), nil
+	case *array.Int64:
+		return arr.Value(i), nil
+	case *array.Int32:
+		return arr.Value(i), nil
+	case *array.Map:
+		keys, ok := arr.Keys().(*array.Int32)
+		if !ok {
+			return nil, fmt.Errorf("unsupported map key type: %s", arr.Keys().DataType())
+		}
+		items, ok := arr.Items().(*array.List)
+		if !ok {
+			return nil, fmt.Errorf("unsupported map item type: %s", arr.Items().DataType())
+		}
+		m := map[string][]int32{}
+		start, end := arr.ValueOffsets(i)
+		for j := int(start); j < int(end); j++ {
+			list, err := listValues[int32](items, j)
+			if err != nil {
+				return nil, err
+			}
+			m[strconv.Itoa(int(keys.Value(j)))] = list
+		}
+		return m, nil
+	case *array.List:
+		return listValues[string](arr, i)
+	}
+	return nil, fmt.Errorf("unsupported type: %s", arr.DataType())
+}
+
+// listValues returns the values of the list at index i of arr.
+func listValues[T string | int32](arr *array.List, i int) ([]T, error) {
+	values, ok := arr.ListValues().(interface {
+		arrow.Array
+		Value(int) T
+	})
+	if !ok {
+		return nil, fmt.Errorf("unsupported list type: %s", arr.DataType())
+	}
+	list := []T{}
+	start, end := arr.ValueOffsets(i)
+	for j := int(start); j < int(end); j++ {
+		list = append(list, values.Value(j))
+	}
+	return list, nil
+}
+
+// sqlInfoString returns the string value of a SqlInfo of the server, or "" if
+// the server does not report it.
+func (d *FlightSQLDatasource) sqlInfoString(ctx context.Context, info flightsql.SqlInfo) (string, error) {
+	infos, err := d.sqlInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	s, _ := infos[info].(string)
+	return s, nil
+}
+
+// identifierQuote returns the character the server quotes identifiers with.
+// If the server fails to report it, the default quote is cached in its place
+// so that the failure is only retried and logged once per metadata TTL.
+func (d *FlightSQLDatasource) identifierQuote(ctx context.Context) string {
+	quote, err := loadMetadata(ctx, d.metadata, "identifier-quote", func(ctx context.Context) (string, error) {
+		quote, err := d.sqlInfoString(ctx, flightsql.SqlInfoIdentifierQuoteChar)
+		if err != nil {
+			logErrorf("Failed to get identifier quote: %s", err)
+		}
+		return quote, nil
+	})
+	if err != nil || quote == "" || quote == " " {
+		return defaultIdentifierQuote
+	}
+	return quote
+}
@@ -0,0 +1,97 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	require.Equal(t, `"a""b"`, quoteIdentifier(`a"b`, ""))
+	require.Equal(t, "`a``b`", quoteIdentifier("a`b", "`"))
+
+	sql, err := adhocFiltersSQL([]adhocFilter{{Key: "host", Operator: "=", Value: "a"}}, "`")
+	require.NoError(t, err)
+	require.Equal(t, "`host` = 'a'", sql)
+}
+
+func TestIntegration_SQLInfo(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	w := httptest.NewRecorder()
+	ds.getSQLInfo(w, httptest.NewRequest(http.MethodGet, "/flightsql/sql-info", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var info struct {
+		ServerName      string   `json:"flight_sql_server_name"`
+		ReadOnly        bool     `json:"flight_sql_server_read_only"`
+		IdentifierQuote string   `json:"sql_identifier_quote_char"`
+		NullOrdering    int64    `json:"sql_null_ordering"`
+		Keywords        []string `json:"sql_keywords"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	require.Equal(t, "db_name", info.ServerName)
+	require.False(t, info.ReadOnly)
+	require.Equal(t, `"`, info.IdentifierQuote)
+	require.Equal(t, int64(flightsql.SqlNullOrderingSortAtStart), info.NullOrdering)
+	require.Contains(t, info.Keywords, "SELECT")
+
+	require.Equal(t, `"`, ds.identifierQuote(context.Background()))
+}
+
+func TestQuotesIdentifiers(t *testing.T) {
+	require.False(t, quotesIdentifiers(queryRequest{Text: "select 1"}))
+	require.True(t, quotesIdentifiers(queryRequest{AdhocFilters: []adhocFilter{{Key: "host", Operator: "=", Value: "a"}}}))
+	require.True(t, quotesIdentifiers(queryRequest{WrapAdhocFilters: true}))
+	require.True(t, quotesIdentifiers(queryRequest{QueryType: string(queryTypeLogsVolume)}))
+	require.True(t, quotesIdentifiers(queryRequest{QueryType: string(queryTypeLogsContext)}))
+}
+
+func TestIntegration_IdentifierQuote_Lazy(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	// Queries not quoting identifiers do not look up the identifier quote.
+	resp := queryDataResponse(t, ds, queryRequest{RefID: "A", Text: "select 1", Format: "table"}, backend.TimeRange{})
+	require.NoError(t, resp.Error)
+	_, ok := ds.metadata.entries.get("identifier-quote")
+	require.False(t, ok)
+
+	resp = queryDataResponse(t, ds, queryRequest{
+		RefID:        "A",
+		Text:         "select 1 as host where $__adhocFilters",
+		Format:       "table",
+		AdhocFilters: []adhocFilter{{Key: "host", Operator: "=", Value: "1"}},
+	}, backend.TimeRange{})
+	require.NoError(t, resp.Error)
+	quote, ok := ds.metadata.entries.get("identifier-quote")
+	require.True(t, ok)
+	require.Equal(t, `"`, quote)
+}
+
+func TestIdentifierQuote_Unavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	cfgJSON, err := json.Marshal(config{Addr: addr, Token: "secret"})
+	require.NoError(t, err)
+	inst, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{JSONData: cfgJSON})
+	require.NoError(t, err)
+	ds := inst.(*FlightSQLDatasource)
+	t.Cleanup(ds.Dispose)
+
+	// The default quote is cached in place of the failure so that it is not
+	// retried by every request.
+	require.Equal(t, defaultIdentifierQuote, ds.identifierQuote(context.Background()))
+	quote, ok := ds.metadata.entries.get("identifier-quote")
+	require.True(t, ok)
+	require.Equal(t, "", quote)
+}
@@ -0,0 +1,220 @@
+package flightsql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// statementName matches a leading `-- name: <name>` comment naming the result
+// frame of a statement.
+var statementName = regexp.MustCompile(`(?i)^--\s*name:\s*(.*?)\s*$`)
+
+// dollarQuote matches the `$$` or `$tag$` opening a dollar-quoted string.
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// statement is a single SQL statement of a query.
+type statement struct {
+	// Text is the text of the statement without the terminating semicolon.
+	Text string
+	// Name is the name given to the statement by a leading `-- name:`
+	// comment.
+	Name string
+}
+
+// queryStatements executes the statements of a query one after another and
+// returns one frame per statement, named after the statement unless the query
+// names its frames. Execution stops at the first statement that fails.
+func (d *FlightSQLDatasource) queryStatements(ctx context.Context, query queryModel, statements []statement) backend.DataResponse {
+	resp := backend.DataResponse{Frames: data.Frames{}}
+	for i, stmt := range statements {
+		name := stmt.Name
+		if name == "" {
+			name = fmt.Sprintf("statement %d", i+1)
+		}
+
+		q := query
+		q.Text = stmt.Text
+		q, err := q.interpolate()
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("%s: %s", name, err))
+		}
+
+		r := d.queryStatement(ctx, q)
+		for _, frame := range r.Frames {
+			// Named statements take precedence over the frame name of the
+			// query.
+			if stmt.Name != "" || frame.Name == "" {
+				frame.Name = name
+			}
+		}
+		resp.Frames = append(resp.Frames, r.Frames...)
+		if r.Error != nil {
+			resp.Error = fmt.Errorf("%s: %w", name, r.Error)
+			resp.Status = r.Status
+			break
+		}
+	}
+	return resp
+}
+
+// splitStatements splits the text of a query into its semicolon separated
+// statements. Semicolons within quoted strings, quoted identifiers, escape
+// strings such as `E'a\'b'`, dollar-quoted strings such as `$$a;b$$` and
+// comments do not separate statements. Statements that consist only of whitespace and
+// comments are dropped.
+func splitStatements(text string) []statement {
+	var (
+		statements []statement
+		start      int
+	)
+	add := func(end int) {
+		if s := text[start:end]; hasCode(s) {
+			statements = append(statements, statement{
+				Text: strings.TrimSpace(s),
+				Name: leadingName(s),
+			})
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\'' && isEscapeString(text, i):
+			i = skipEscapeString(text, i)
+		case c == '\'' || c == '"':
+			i = skipQuoted(text, i)
+		case c == '$':
+			i = skipDollarQuoted(text, i)
+		case c == '-' && strings.HasPrefix(text[i:], "--"):
+			i = skipLineComment(text, i)
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			i = skipBlockComment(text, i)
+		case c == ';':
+			add(i)
+		}
+	}
+	if start < len(text) {
+		add(len(text))
+	}
+	return statements
+}
+
+// skipQuoted returns the index of the quote closing the quoted string or
+// identifier starting at i. Doubled quotes are escapes and do not close it.
+func skipQuoted(text string, i int) int {
+	quote := text[i]
+	for i++; i < len(text); i++ {
+		if text[i] != quote {
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(text)
+}
+
+// isEscapeString reports whether the quote at i opens an escape string, which
+// is a string constant prefixed with E.
+func isEscapeString(text string, i int) bool {
+	if i == 0 || (text[i-1] != 'E' && text[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentifierChar(text[i-2])
+}
+
+// skipEscapeString returns the index of the quote closing the escape string
+// starting at i. Both backslashes and doubled quotes escape quotes.
+func skipEscapeString(text string, i int) int {
+	for i++; i < len(text); i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		case text[i] != '\'':
+		case i+1 < len(text) && text[i+1] == '\'':
+			i++
+		default:
+			return i
+		}
+	}
+	return len(text)
+}
+
+// skipDollarQuoted returns the index of the last character of the
+// dollar-quoted string starting at i. If no dollar-quoted string starts at i,
+// i is returned.
+func skipDollarQuoted(text string, i int) int {
+	tag := dollarQuote.FindString(text[i:])
+	if tag == "" {
+		return i
+	}
+	if end := strings.Index(text[i+len(tag):], tag); end != -1 {
+		return i + len(tag) + end + len(tag) - 1
+	}
+	return len(text)
+}
+
+// isIdentifierChar reports whether c may be part of an unquoted identifier.
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// skipLineComment returns the index of the newline ending the line comment
+// starting at i.
+func skipLineComment(text string, i int) int {
+	if end := strings.IndexByte(text[i:], '\n'); end != -1 {
+		return i + end
+	}
+	return len(text)
+}
+
+// skipBlockComment returns the index of the last character of the block
+// comment starting at i.
+func skipBlockComment(text string, i int) int {
+	if end := strings.Index(text[i+2:], "*/"); end != -1 {
+		return i + 2 + end + 1
+	}
+	return len(text)
+}
+
+// hasCode reports whether text contains anything besides whitespace and
+// comments.
+func hasCode(text string) bool {
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == '-' && strings.HasPrefix(text[i:], "--"):
+			i = skipLineComment(text, i)
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			i = skipBlockComment(text, i)
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// leadingName returns the name given by a `-- name:` comment among the
+// comment lines preceding the code of a statement.
+func leadingName(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return ""
+		}
+		if m := statementName.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package flightsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	cs := []struct {
+		name string
+		in   string
+		out  []statement
+	}{
+		{
+			name: "single",
+			in:   `select 1`,
+			out:  []statement{{Text: `select 1`}},
+		},
+		{
+			name: "trailing semicolon",
+			in:   "select 1;\n-- done\n",
+			out:  []statement{{Text: `select 1`}},
+		},
+		{
+			name: "multiple",
+			in:   `select 1; select 2`,
+			out:  []statement{{Text: `select 1`}, {Text: `select 2`}},
+		},
+		{
+			name: "quotes",
+			in:   `select 'a;b', "c;d", 'it''s;'; select 2`,
+			out:  []statement{{Text: `select 'a;b', "c;d", 'it''s;'`}, {Text: `select 2`}},
+		},
+		{
+			name: "escape strings",
+			in:   `select E'a\';b', e'c\\', 'd;'; select 2`,
+			out:  []statement{{Text: `select E'a\';b', e'c\\', 'd;'`}, {Text: `select 2`}},
+		},
+		{
+			name: "backslashes in standard strings",
+			in:   `select 'a\'; select 2`,
+			out:  []statement{{Text: `select 'a\'`}, {Text: `select 2`}},
+		},
+		{
+			name: "dollar quotes",
+			in:   `select $$a;b$$, $fn$c;$$;d$fn$ from x where time >= $__timeFrom; select 2`,
+			out:  []statement{{Text: `select $$a;b$$, $fn$c;$$;d$fn$ from x where time >= $__timeFrom`}, {Text: `select 2`}},
+		},
+		{
+			name: "comments",
+			in:   "select 1 -- one; two\n; /* three; */ select 3",
+			out:  []statement{{Text: "select 1 -- one; two"}, {Text: `/* three; */ select 3`}},
+		},
+		{
+			name: "names",
+			in:   "-- name: cpu\nselect 1;\n-- other comment\n-- Name: memory usage \nselect 2; select 3 -- name: ignored",
+			out: []statement{
+				{Text: "-- name: cpu\nselect 1", Name: "cpu"},
+				{Text: "-- other comment\n-- Name: memory usage \nselect 2", Name: "memory usage"},
+				{Text: "select 3 -- name: ignored"},
+			},
+		},
+	}
+	for _, c := range cs {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.out, splitStatements(c.in))
+		})
+	}
+}
+
+func TestIntegration_QueryData_Statements(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	resp, err := ds.QueryData(context.Background(),
+		&backend.QueryDataRequest{
+			Queries: []backend.DataQuery{
+				{
+					RefID: "A",
+					JSON:  mustQueryJSON(t, "A", "-- name: ints\nselect * from intTable; select 1 as one"),
+				},
+				{
+					RefID: "B",
+					JSON:  mustQueryJSON(t, "B", "select 1 as one; select * from missing"),
+				},
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	respA := resp.Responses["A"]
+	require.NoError(t, respA.Error)
+	require.Len(t, respA.Frames, 2)
+	require.Equal(t, "ints", respA.Frames[0].Name)
+	require.Equal(t, 4, respA.Frames[0].Rows())
+	require.Equal(t, "statement 2", respA.Frames[1].Name)
+	require.Equal(t, "one", respA.Frames[1].Fields[0].Name)
+
+	// Frames of the statements preceding a failing one are kept.
+	respB := resp.Responses["B"]
+	require.Error(t, respB.Error)
+	require.Len(t, respB.Frames, 1)
+}
@@ -0,0 +1,200 @@
+package flightsql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+const (
+	// tagCacheTTL is how long the suggested keys and values of ad-hoc filters
+	// are cached.
+	tagCacheTTL = time.Minute
+	// maxTagValues bounds the number of values suggested for a key of ad-hoc
+	// filters.
+	maxTagValues = 1000
+)
+
+// newTagCache returns the cache of the suggested keys and values of ad-hoc
+// filters.
+func newTagCache() *lruCache[[]string] {
+	return newLRUCache(tagCacheTTL, 0, 0, func(tags []string) int {
+		return len(tags)
+	})
+}
+
+// getTagKeys suggests the keys of ad-hoc filters, which are the columns of
+// the table given by the table query parameter or of all tables. Time
+// columns are left out since they are filtered by the time range.
+func (d *FlightSQLDatasource) getTagKeys(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	table := params.Get("table")
+	key := fmt.Sprintf("keys:%s:%s:%s", params.Get("catalog"), params.Get("schema"), table)
+	keys, ok := d.tags.get(key)
+	if !ok {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		tables, err := d.findTables(ctx, params, table)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		seen := map[string]bool{}
+		for _, t := range tables {
+			if t.Columns == nil {
+				continue
+			}
+			for _, f := range t.Columns.Fields() {
+				if f.Type.ID() != arrow.TIMESTAMP && !seen[f.Name] {
+					seen[f.Name] = true
+					keys = append(keys, f.Name)
+				}
+			}
+		}
+		sort.Strings(keys)
+		d.tags.set(key, keys)
+	}
+	writeTags(w, keys)
+}
+
+// getTagValues suggests the values of the key query parameter for ad-hoc
+// filters. They are the distinct values of the column of the table given by
+// the table query parameter, bounded by [maxTagValues]. If the from and to
+// query parameters give a time range in milliseconds since the epoch, only
+// rows in the time range are considered, using the column given by the
+// timeColumn query parameter or the first time column of the table.
+func (d *FlightSQLDatasource) getTagValues(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	column, table := params.Get("key"), params.Get("table")
+	if column == "" || table == "" {
+		http.Error(w, `query parameters "key" and "table" are required`, http.StatusBadRequest)
+		return
+	}
+	tr, err := tagTimeRange(params.Get("from"), params.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := fmt.Sprintf("values:%s:%s:%s:%s:%s:%d:%d", params.Get("catalog"), params.Get("schema"), table, column, params.Get("timeColumn"), tr.From.UnixMilli(), tr.To.UnixMilli())
+	values, ok := d.tags.get(key)
+	if !ok {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		tables, err := d.findTables(ctx, params, table)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !requireSingleTable(w, table, tables) {
+			return
+		}
+		sql, err := tagValuesSQL(tables[0], column, params.Get("timeColumn"), tr, d.identifierQuote(ctx))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		frame, _, err := d.queryFrame(ctx, sql)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		values = []string{}
+		for i := 0; i < frame.Rows(); i++ {
+			if !isNull(frame.Fields[0], i) {
+				values = append(values, labelAt(frame.Fields[0], i))
+			}
+		}
+		d.tags.set(key, values)
+	}
+	writeTags(w, values)
+}
+
+// tagTimeRange parses the time range of a tag values request. The time range
+// is zero if neither bound is given. Bounds are truncated to the minute so
+// that requests for relative time ranges hit the cache.
+func tagTimeRange(from, to string) (backend.TimeRange, error) {
+	var tr backend.TimeRange
+	if from == "" && to == "" {
+		return tr, nil
+	}
+	fromMs, err := strconv.ParseInt(from, 10, 64)
+	if err != nil {
+		return tr, fmt.Errorf("invalid from: %q", from)
+	}
+	toMs, err := strconv.ParseInt(to, 10, 64)
+	if err != nil {
+		return tr, fmt.Errorf("invalid to: %q", to)
+	}
+	tr.From = time.UnixMilli(fromMs).UTC().Truncate(time.Minute)
+	tr.To = time.UnixMilli(toMs).UTC().Truncate(time.Minute).Add(time.Minute)
+	return tr, nil
+}
+
+// tagValuesSQL returns the SQL selecting the distinct values of a column of
+// a table in the time range tr, if it is not zero. Identifiers are quoted with
+// quote.
+func tagValuesSQL(table tableInfo, column, timeColumn string, tr backend.TimeRange, quote string) (string, error) {
+	if table.Columns == nil {
+		return "", fmt.Errorf("columns of table %q not available", table.Name)
+	}
+	if fields, _ := table.Columns.FieldsByName(column); len(fields) == 0 {
+		return "", fmt.Errorf("column %q not found in table %q", column, table.Name)
+	}
+
+	var where []string
+	where = append(where, fmt.Sprintf("%s is not null", quoteIdentifier(column, quote)))
+	if !tr.From.IsZero() {
+		if timeColumn == "" {
+			for _, f := range table.Columns.Fields() {
+				if f.Type.ID() == arrow.TIMESTAMP {
+					timeColumn = f.Name
+					break
+				}
+			}
+		}
+		if timeColumn != "" {
+			query := sqlutil.Query{TimeRange: tr}
+			from, _ := macroFrom(&query, nil)
+			to, _ := macroTo(&query, nil)
+			where = append(where, fmt.Sprintf("%s >= %s and %s <= %s", quoteIdentifier(timeColumn, quote), from, quoteIdentifier(timeColumn, quote), to))
+		}
+	}
+
+	return fmt.Sprintf("select distinct %s from %s where %s order by %s limit %d",
+		quoteIdentifier(column, quote), quoteTable(table.tableRef, quote), strings.Join(where, " and "), quoteIdentifier(column, quote), maxTagValues), nil
+}
+
+// quoteTable returns the name of a table qualified by its catalog and schema
+// and quoted with quote for use in SQL.
+func quoteTable(table tableRef, quote string) string {
+	var parts []string
+	for _, part := range []string{table.Catalog, table.Schema, table.Name} {
+		if part != "" {
+			parts = append(parts, quoteIdentifier(part, quote))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// writeTags writes suggested keys or values of ad-hoc filters as a frame with
+// a text field.
+func writeTags(w http.ResponseWriter, tags []string) {
+	var resp backend.DataResponse
+	resp.Frames = data.Frames{data.NewFrame("", data.NewField("text", nil, tags))}
+	if err := writeDataResponse(w, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
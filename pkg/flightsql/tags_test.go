@@ -0,0 +1,103 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagValuesSQL(t *testing.T) {
+	table := tableInfo{
+		tableRef: tableRef{Catalog: "main", Name: "cpu"},
+		Columns: arrow.NewSchema([]arrow.Field{
+			{Name: "host", Type: arrow.BinaryTypes.String},
+			{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+			{Name: "created", Type: arrow.FixedWidthTypes.Timestamp_ns},
+		}, nil),
+	}
+
+	sql, err := tagValuesSQL(table, "host", "", backend.TimeRange{}, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select distinct "host" from "main"."cpu" where "host" is not null order by "host" limit 1000`, sql)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	sql, err = tagValuesSQL(table, "host", "", tr, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Equal(t, `select distinct "host" from "main"."cpu" where "host" is not null and "time" >= cast('2023-01-01T00:00:00Z' as timestamp) and "time" <= cast('2023-01-01T01:00:00Z' as timestamp) order by "host" limit 1000`, sql)
+
+	sql, err = tagValuesSQL(table, "host", "created", tr, defaultIdentifierQuote)
+	require.NoError(t, err)
+	require.Contains(t, sql, `"created" >= `)
+
+	_, err = tagValuesSQL(table, "missing", "", tr, defaultIdentifierQuote)
+	require.EqualError(t, err, `column "missing" not found in table "cpu"`)
+}
+
+func TestTagTimeRange(t *testing.T) {
+	tr, err := tagTimeRange("", "")
+	require.NoError(t, err)
+	require.True(t, tr.From.IsZero())
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr, err = tagTimeRange("1672531210000", "1672534810000")
+	require.NoError(t, err)
+	require.Equal(t, from, tr.From)
+	require.Equal(t, from.Add(time.Hour+time.Minute), tr.To)
+
+	_, err = tagTimeRange("1672531210000", "")
+	require.EqualError(t, err, `invalid to: ""`)
+}
+
+// resourceFrames decodes the frames of a data response written by a resource
+// handler.
+func resourceFrames(t *testing.T, w *httptest.ResponseRecorder) []*data.Frame {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Frames []*data.Frame `json:"frames"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Frames
+}
+
+func TestIntegration_Tags(t *testing.T) {
+	ds := newTestDatasource(t, config{}, logsTable...)
+
+	w := httptest.NewRecorder()
+	ds.getTagKeys(w, httptest.NewRequest(http.MethodGet, "/flightsql/tag-keys?table=logs", nil))
+	frames := resourceFrames(t, w)
+	require.Equal(t, []string{"level", "message", "service", "ts"}, extractFieldValues[string](t, frames[0].Fields[0]))
+
+	w = httptest.NewRecorder()
+	ds.getTagValues(w, httptest.NewRequest(http.MethodGet, "/flightsql/tag-values?table=logs&key=level", nil))
+	frames = resourceFrames(t, w)
+	require.Equal(t, []string{"error", "info", "warn"}, extractFieldValues[string](t, frames[0].Fields[0]))
+
+	// Values are cached.
+	_, _, err := ds.queryFrame(context.Background(), "insert into logs values (1672531440, 'x', 'debug', 'api')")
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	ds.getTagValues(w, httptest.NewRequest(http.MethodGet, "/flightsql/tag-values?table=logs&key=level", nil))
+	frames = resourceFrames(t, w)
+	require.Len(t, extractFieldValues[string](t, frames[0].Fields[0]), 3)
+	frame, _, err := ds.queryFrame(context.Background(), "select distinct level from logs")
+	require.NoError(t, err)
+	require.Equal(t, 4, frame.Rows())
+
+	w = httptest.NewRecorder()
+	ds.getTagValues(w, httptest.NewRequest(http.MethodGet, "/flightsql/tag-values?table=missing&key=level", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	ds.getTagValues(w, httptest.NewRequest(http.MethodGet, "/flightsql/tag-values?table=logs", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,686 @@
+package flightsql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// timeUnits maps the units accepted for numeric time columns to their
+// duration.
+var timeUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// timeFieldIndex returns the index of the time field of the frame or -1 if
+// there is none. The time field is the field named column if column is given
+// and otherwise the first timestamp field.
+func timeFieldIndex(frame *data.Frame, column string) int {
+	if column != "" {
+		_, idx := frame.FieldByName(column)
+		if idx != -1 && !isTimeField(frame.Fields[idx]) {
+			return -1
+		}
+		return idx
+	}
+	for i, field := range frame.Fields {
+		if isTimeField(field) {
+			return i
+		}
+	}
+	return -1
+}
+
+// queryTimeField returns the time field of the results of a query or nil if
+// there is none. Numeric time columns named by the query are converted from
+// the epoch in the unit chosen by the query.
+func queryTimeField(frame *data.Frame, query queryModel) *data.Field {
+	if idx := timeFieldIndex(frame, query.TimeColumn); idx != -1 {
+		return frame.Fields[idx]
+	}
+	if query.TimeColumn == "" {
+		return nil
+	}
+	field, _ := frame.FieldByName(query.TimeColumn)
+	if field == nil {
+		return nil
+	}
+	converted, err := epochField(field, query.TimeUnit)
+	if err != nil {
+		return nil
+	}
+	return converted
+}
+
+// prepareTimeField returns the frame with the time column of a time series
+// query moved to the first field so that it is used by the long to wide
+// conversion. Numeric time columns named by the query are converted from the
+// epoch in the unit chosen by the query. The frame itself is not modified.
+func prepareTimeField(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	fields := make([]*data.Field, len(frame.Fields))
+	copy(fields, frame.Fields)
+
+	idx := -1
+	if query.TimeColumn != "" {
+		var field *data.Field
+		field, idx = frame.FieldByName(query.TimeColumn)
+		if idx == -1 {
+			return nil, fmt.Errorf("time column %q not found", query.TimeColumn)
+		}
+		if !isTimeField(field) {
+			converted, err := epochField(field, query.TimeUnit)
+			if err != nil {
+				return nil, fmt.Errorf("time column %q: %w", query.TimeColumn, err)
+			}
+			fields[idx] = converted
+		}
+	} else {
+		idx = timeFieldIndex(frame, "")
+	}
+	if idx == -1 {
+		return nil, fmt.Errorf("no time column found")
+	}
+
+	if idx != 0 {
+		field := fields[idx]
+		copy(fields[1:idx+1], fields[:idx])
+		fields[0] = field
+	}
+	out := *frame
+	out.Fields = fields
+	return &out, nil
+}
+
+// epochField converts a numeric field holding times since the epoch in the
+// given unit into a time field.
+func epochField(field *data.Field, unit time.Duration) (*data.Field, error) {
+	if !field.Type().Numeric() {
+		return nil, fmt.Errorf("unsupported type %s", field.Type())
+	}
+	if unit == 0 {
+		unit = time.Second
+	}
+
+	var out *data.Field
+	if field.Nullable() {
+		out = data.NewField(field.Name, field.Labels, make([]*time.Time, field.Len()))
+	} else {
+		out = data.NewField(field.Name, field.Labels, make([]time.Time, field.Len()))
+	}
+	if field.Config != nil {
+		config := *field.Config
+		out.Config = &config
+	}
+
+	for i := 0; i < field.Len(); i++ {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		t := epochTime(v, unit)
+		if out.Nullable() {
+			out.Set(i, &t)
+			continue
+		}
+		out.Set(i, t)
+	}
+	return out, nil
+}
+
+// epochTime converts a number of units since the epoch into a time.
+func epochTime(v any, unit time.Duration) time.Time {
+	switch n := v.(type) {
+	case float32:
+		return time.Unix(0, int64(float64(n)*float64(unit))).UTC()
+	case float64:
+		return time.Unix(0, int64(n*float64(unit))).UTC()
+	case uint64:
+		return time.Unix(0, int64(n)*int64(unit)).UTC()
+	}
+	var n int64
+	switch i := v.(type) {
+	case int8:
+		n = int64(i)
+	case int16:
+		n = int64(i)
+	case int32:
+		n = int64(i)
+	case int64:
+		n = i
+	case uint8:
+		n = int64(i)
+	case uint16:
+		n = int64(i)
+	case uint32:
+		n = int64(i)
+	}
+	return time.Unix(0, n*int64(unit)).UTC()
+}
+
+// duplicateMode is how a time series query handles rows of a series that
+// share their time.
+type duplicateMode int
+
+const (
+	// duplicateModeWarn keeps the last of the rows and adds a notice to the
+	// frame.
+	duplicateModeWarn duplicateMode = iota
+	// duplicateModeFirst keeps the first of the rows.
+	duplicateModeFirst
+	// duplicateModeLast keeps the last of the rows.
+	duplicateModeLast
+	// duplicateModeSum sums the values of the rows.
+	duplicateModeSum
+	// duplicateModeAvg averages the values of the rows.
+	duplicateModeAvg
+	// duplicateModeMin keeps the smallest value of the rows.
+	duplicateModeMin
+	// duplicateModeMax keeps the largest value of the rows.
+	duplicateModeMax
+)
+
+// duplicateModes maps the duplicates modes accepted in query requests to
+// their [duplicateMode].
+var duplicateModes = map[string]duplicateMode{
+	"":      duplicateModeWarn,
+	"warn":  duplicateModeWarn,
+	"first": duplicateModeFirst,
+	"last":  duplicateModeLast,
+	"sum":   duplicateModeSum,
+	"avg":   duplicateModeAvg,
+	"min":   duplicateModeMin,
+	"max":   duplicateModeMax,
+}
+
+// seriesOrder compares the rows of a time series frame by time and then by
+// the values of its label fields. The time field must be the first field of
+// the frame.
+type seriesOrder struct {
+	frame  *data.Frame
+	labels []int
+}
+
+// newSeriesOrder returns the order of the rows of the frame. It returns an
+// error if the time field has null values.
+func newSeriesOrder(frame *data.Frame) (seriesOrder, error) {
+	for i := 0; i < frame.Rows(); i++ {
+		if isNull(frame.Fields[0], i) {
+			return seriesOrder{}, fmt.Errorf("time column has null values")
+		}
+	}
+	return seriesOrder{
+		frame:  frame,
+		labels: frame.TypeIndices(data.FieldTypeString, data.FieldTypeNullableString, data.FieldTypeBool, data.FieldTypeNullableBool),
+	}, nil
+}
+
+// compare returns -1, 0 or 1 if row a sorts before, with or after row b.
+func (o seriesOrder) compare(a, b int) int {
+	ta, tb := timeAt(o.frame.Fields[0], a), timeAt(o.frame.Fields[0], b)
+	switch {
+	case ta.Before(tb):
+		return -1
+	case ta.After(tb):
+		return 1
+	}
+	return o.compareLabels(a, b)
+}
+
+// compareLabels returns -1, 0 or 1 if the labels of row a sort before, with
+// or after those of row b.
+func (o seriesOrder) compareLabels(a, b int) int {
+	for _, idx := range o.labels {
+		la, lb := labelAt(o.frame.Fields[idx], a), labelAt(o.frame.Fields[idx], b)
+		switch {
+		case la < lb:
+			return -1
+		case la > lb:
+			return 1
+		}
+	}
+	return 0
+}
+
+// labelAt returns the value of a label field at row i as a string. Null
+// values are empty strings.
+func labelAt(field *data.Field, i int) string {
+	v, ok := field.ConcreteAt(i)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// sortTimeSeries returns the frame sorted ascending by time and then by the
+// values of its label fields, as required by the long to wide conversion. The
+// sort is stable and the frame is returned as is if it is already sorted.
+// The time field must be the first field of the frame.
+func sortTimeSeries(frame *data.Frame) (*data.Frame, error) {
+	order, err := newSeriesOrder(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := true
+	for i := 1; i < frame.Rows(); i++ {
+		if order.compare(i-1, i) > 0 {
+			sorted = false
+			break
+		}
+	}
+	if sorted {
+		return frame, nil
+	}
+
+	rows := make([]int, frame.Rows())
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return order.compare(rows[i], rows[j]) < 0
+	})
+
+	out := emptyCopy(frame)
+	for _, i := range rows {
+		appendRow(out, frame, i)
+	}
+	return out, nil
+}
+
+// dedupeTimeSeries returns a sorted time series frame with the rows of each
+// series that share their time merged into one according to the duplicates
+// mode of the query. In the default mode the last row is kept and a notice
+// reports the number of rows dropped, since the long to wide conversion would
+// otherwise silently keep the last row. Frames without duplicates are
+// returned as is.
+func dedupeTimeSeries(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	order, err := newSeriesOrder(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out     = emptyCopy(frame)
+		dropped int
+		values  = frame.TimeSeriesSchema().ValueIndices
+	)
+	for start := 0; start < frame.Rows(); {
+		end := start + 1
+		for end < frame.Rows() && order.compare(start, end) == 0 {
+			end++
+		}
+		dropped += end - start - 1
+
+		switch query.Duplicates {
+		case duplicateModeFirst:
+			appendRow(out, frame, start)
+		case duplicateModeSum, duplicateModeAvg, duplicateModeMin, duplicateModeMax:
+			appendRow(out, frame, end-1)
+			for _, idx := range values {
+				if !frame.Fields[idx].Type().Numeric() {
+					continue
+				}
+				v, err := aggregateRows(frame.Fields[idx], start, end, query.Duplicates)
+				if err != nil {
+					return nil, fmt.Errorf("aggregate %s: %w", frame.Fields[idx].Name, err)
+				}
+				out.Fields[idx].Set(out.Rows()-1, v)
+			}
+		default:
+			appendRow(out, frame, end-1)
+		}
+		start = end
+	}
+
+	if dropped == 0 {
+		return frame, nil
+	}
+	if query.Duplicates == duplicateModeWarn {
+		out.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d rows share their time and labels with another row and have been dropped, keeping the last row of each. Choose how to handle duplicates to aggregate them instead.", dropped),
+		})
+	}
+	return out, nil
+}
+
+// aggregateRows aggregates the values of a numeric field in the rows from
+// start to end, ignoring null values. It returns null if all values are null.
+func aggregateRows(field *data.Field, start, end int, mode duplicateMode) (any, error) {
+	var (
+		agg float64
+		n   int
+	)
+	for i := start; i < end; i++ {
+		if isNull(field, i) {
+			continue
+		}
+		v, err := field.FloatAt(i)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case n == 0:
+			agg = v
+		case mode == duplicateModeSum || mode == duplicateModeAvg:
+			agg += v
+		case mode == duplicateModeMin:
+			agg = math.Min(agg, v)
+		case mode == duplicateModeMax:
+			agg = math.Max(agg, v)
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if mode == duplicateModeAvg {
+		agg /= float64(n)
+	}
+	return numericValue(field, agg)
+}
+
+// splitTimeSeries splits a sorted time series frame into one frame per series
+// and value field. Each frame holds the time field and the rows of one value
+// field for one combination of the values of the label fields, which become
+// the labels of the value field. Value fields keep their type. Frames are
+// ordered by their labels and then by the order of the value fields, and only
+// the first keeps the notices of the frame. The time field must be the first
+// field of the frame.
+func splitTimeSeries(frame *data.Frame) data.Frames {
+	order, err := newSeriesOrder(frame)
+	if err != nil || frame.Rows() == 0 {
+		return data.Frames{frame}
+	}
+	values := frame.TimeSeriesSchema().ValueIndices
+	if len(values) == 0 {
+		return data.Frames{frame}
+	}
+
+	var (
+		series []int // the first row of each series
+		first  = map[string]int{}
+		rows   = map[int][]int{}
+	)
+	for i := 0; i < frame.Rows(); i++ {
+		labels := make([]string, len(order.labels))
+		for j, idx := range order.labels {
+			labels[j] = labelAt(frame.Fields[idx], i)
+		}
+		key := strings.Join(labels, "\x00")
+		s, ok := first[key]
+		if !ok {
+			s = i
+			first[key] = i
+			series = append(series, i)
+		}
+		rows[s] = append(rows[s], i)
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		return order.compareLabels(series[i], series[j]) < 0
+	})
+
+	var frames data.Frames
+	for _, s := range series {
+		labels := data.Labels{}
+		for _, idx := range order.labels {
+			labels[frame.Fields[idx].Name] = labelAt(frame.Fields[idx], s)
+		}
+		for _, idx := range values {
+			src := frame.Fields[idx]
+			times := data.NewFieldFromFieldType(frame.Fields[0].Type(), 0)
+			times.Name = frame.Fields[0].Name
+			times.Config = frame.Fields[0].Config
+			field := data.NewFieldFromFieldType(src.Type(), 0)
+			field.Name = src.Name
+			field.Config = src.Config
+			field.Labels = src.Labels.Copy()
+			for k, v := range labels {
+				if field.Labels == nil {
+					field.Labels = data.Labels{}
+				}
+				field.Labels[k] = v
+			}
+			for _, i := range rows[s] {
+				times.Append(frame.Fields[0].At(i))
+				field.Append(src.At(i))
+			}
+
+			out := data.NewFrame(frame.Name, times, field)
+			var meta data.FrameMeta
+			if frame.Meta != nil {
+				meta = *frame.Meta
+			}
+			if len(frames) > 0 {
+				meta.Notices = nil
+			}
+			meta.Type = data.FrameTypeTimeSeriesMulti
+			out.Meta = &meta
+			frames = append(frames, out)
+		}
+	}
+	return frames
+}
+
+// fillMode is how a time series query fills missing values.
+type fillMode int
+
+const (
+	// fillModeNone leaves missing values as produced by the long to wide
+	// conversion.
+	fillModeNone fillMode = iota
+	// fillModeNull fills missing values with null.
+	fillModeNull
+	// fillModePrevious fills missing values with the previous value of the
+	// series.
+	fillModePrevious
+	// fillModeLinear interpolates missing values linearly between the values
+	// around them.
+	fillModeLinear
+	// fillModeValue fills missing values with a constant.
+	fillModeValue
+)
+
+// fillModes maps the fill modes accepted in query requests to their
+// [fillMode].
+var fillModes = map[string]fillMode{
+	"":         fillModeNone,
+	"none":     fillModeNone,
+	"null":     fillModeNull,
+	"previous": fillModePrevious,
+	"linear":   fillModeLinear,
+	"value":    fillModeValue,
+}
+
+// maxFillPoints bounds the number of time buckets that are added to fill a
+// time series.
+const maxFillPoints = rowLimit
+
+// nullableValues returns the frame with its numeric fields other than the time
+// field replaced by nullable copies so that missing values can be told apart
+// from zero values. The frame itself is not modified.
+func nullableValues(frame *data.Frame) *data.Frame {
+	out := *frame
+	out.Fields = make([]*data.Field, len(frame.Fields))
+	copy(out.Fields, frame.Fields)
+	for i, field := range frame.Fields {
+		if field.Nullable() || isTimeField(field) || !field.Type().Numeric() {
+			continue
+		}
+		nullable := data.NewFieldFromFieldType(field.Type().NullableType(), field.Len())
+		nullable.Name = field.Name
+		nullable.Labels = field.Labels
+		if field.Config != nil {
+			config := *field.Config
+			nullable.Config = &config
+		}
+		for j := 0; j < field.Len(); j++ {
+			nullable.SetConcrete(j, field.At(j))
+		}
+		out.Fields[i] = nullable
+	}
+	return &out
+}
+
+// fillTimeSeries returns a copy of a wide time series frame with a row for
+// every interval of the time range of the query and its missing values filled
+// according to the fill mode of the query. Intervals that contain a row are
+// left as they are. The time field must be the first field of the frame.
+func fillTimeSeries(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	frame = nullableValues(frame)
+
+	times := make([]time.Time, frame.Rows())
+	for i := range times {
+		v, ok := frame.Fields[0].ConcreteAt(i)
+		if !ok {
+			return nil, fmt.Errorf("time column has null values")
+		}
+		times[i] = v.(time.Time)
+		if i > 0 && times[i].Before(times[i-1]) {
+			return nil, fmt.Errorf("time series must be sorted ascending by time to be filled")
+		}
+	}
+
+	out := emptyCopy(frame)
+	appendEmpty := func(t time.Time) {
+		for j, f := range out.Fields {
+			if j == 0 {
+				if f.Nullable() {
+					f.Append(&t)
+				} else {
+					f.Append(t)
+				}
+				continue
+			}
+			f.Extend(1)
+		}
+	}
+
+	var (
+		i        int
+		interval = query.Interval
+		tr       = query.TimeRange
+	)
+	if interval > 0 && tr.To.After(tr.From) && tr.To.Sub(tr.From)/interval <= maxFillPoints {
+		for t := tr.From.Truncate(interval); !t.After(tr.To); t = t.Add(interval) {
+			for ; i < len(times) && times[i].Before(t); i++ {
+				appendRow(out, frame, i)
+			}
+			if i < len(times) && times[i].Before(t.Add(interval)) {
+				continue
+			}
+			appendEmpty(t)
+		}
+	}
+	for ; i < len(times); i++ {
+		appendRow(out, frame, i)
+	}
+
+	for _, field := range out.Fields[1:] {
+		if err := fillField(field, out.Fields[0], query); err != nil {
+			return nil, fmt.Errorf("fill %s: %w", field.Name, err)
+		}
+	}
+	return out, nil
+}
+
+// fillField fills the null values of a nullable field according to the fill
+// mode of the query. Linear interpolation and constant values only apply to
+// numeric fields.
+func fillField(field, times *data.Field, query queryModel) error {
+	if !field.Nullable() {
+		return nil
+	}
+	numeric := field.Type().Numeric()
+
+	switch query.Fill {
+	case fillModePrevious:
+		for i, prev := 0, -1; i < field.Len(); i++ {
+			if !isNull(field, i) {
+				prev = i
+				continue
+			}
+			if prev != -1 {
+				field.Set(i, field.CopyAt(prev))
+			}
+		}
+	case fillModeValue:
+		if !numeric {
+			return nil
+		}
+		for i := 0; i < field.Len(); i++ {
+			if !isNull(field, i) {
+				continue
+			}
+			v, err := numericValue(field, query.FillValue)
+			if err != nil {
+				return err
+			}
+			field.Set(i, v)
+		}
+	case fillModeLinear:
+		if !numeric {
+			return nil
+		}
+		for i, prev := 0, -1; i < field.Len(); i++ {
+			if isNull(field, i) {
+				continue
+			}
+			if prev != -1 && i-prev > 1 {
+				if err := interpolate(field, times, prev, i); err != nil {
+					return err
+				}
+			}
+			prev = i
+		}
+	}
+	return nil
+}
+
+// interpolate sets the values of the field between the rows from and to by
+// linear interpolation over time.
+func interpolate(field, times *data.Field, from, to int) error {
+	v0, err := field.FloatAt(from)
+	if err != nil {
+		return err
+	}
+	v1, err := field.FloatAt(to)
+	if err != nil {
+		return err
+	}
+	t0 := timeAt(times, from)
+	span := float64(timeAt(times, to).Sub(t0))
+	for i := from + 1; i < to; i++ {
+		ratio := float64(timeAt(times, i).Sub(t0)) / span
+		v, err := numericValue(field, v0+(v1-v0)*ratio)
+		if err != nil {
+			return err
+		}
+		field.Set(i, v)
+	}
+	return nil
+}
+
+// numericValue converts v to the type of the numeric field.
+func numericValue(field *data.Field, v float64) (any, error) {
+	return data.GetMissing(&data.FillMissing{Mode: data.FillModeValue, Value: v}, field, -1)
+}
+
+// isNull reports whether the value of the field at row i is null.
+func isNull(field *data.Field, i int) bool {
+	_, ok := field.ConcreteAt(i)
+	return !ok
+}
+
+// timeAt returns the time of the time field at row i, which must not be null.
+func timeAt(times *data.Field, i int) time.Time {
+	v, _ := times.ConcreteAt(i)
+	return v.(time.Time)
+}
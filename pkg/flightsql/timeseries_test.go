@@ -0,0 +1,456 @@
+package flightsql
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeFieldIndex(t *testing.T) {
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []string{"not a time"}),
+		data.NewField("event_ts", nil, []time.Time{{}}),
+		data.NewField("_time", nil, []*time.Time{nil}),
+	)
+	require.Equal(t, 1, timeFieldIndex(frame, ""))
+	require.Equal(t, 2, timeFieldIndex(frame, "_time"))
+	require.Equal(t, -1, timeFieldIndex(frame, "time"))
+	require.Equal(t, -1, timeFieldIndex(frame, "missing"))
+}
+
+func TestQueryTimeField(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{ts}),
+		data.NewField("epoch", nil, []int64{ts.UnixMilli()}),
+	)
+	require.Same(t, frame.Fields[0], queryTimeField(frame, queryModel{}))
+
+	epoch := queryTimeField(frame, queryModel{TimeColumn: "epoch", TimeUnit: time.Millisecond})
+	require.Equal(t, []time.Time{ts}, extractFieldValues[time.Time](t, epoch))
+	require.Equal(t, data.FieldTypeInt64, frame.Fields[1].Type())
+
+	require.Nil(t, queryTimeField(frame, queryModel{TimeColumn: "missing"}))
+}
+
+func TestPrepareTimeField(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	t.Run("detect", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("host", nil, []string{"a"}),
+			data.NewField("timestamp", nil, []time.Time{ts}),
+			data.NewField("value", nil, []int64{1}),
+		)
+		out, err := prepareTimeField(frame, queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, "timestamp", out.Fields[0].Name)
+		require.Equal(t, "host", out.Fields[1].Name)
+		require.Equal(t, "value", out.Fields[2].Name)
+
+		// The frame itself is left untouched.
+		require.Equal(t, "host", frame.Fields[0].Name)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		frame := data.NewFrame("", data.NewField("value", nil, []int64{1}))
+		_, err := prepareTimeField(frame, queryModel{})
+		require.EqualError(t, err, "no time column found")
+		_, err = prepareTimeField(frame, queryModel{TimeColumn: "ts"})
+		require.EqualError(t, err, `time column "ts" not found`)
+	})
+
+	t.Run("epoch", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("value", nil, []float64{1.5, 2.5}),
+			data.NewField("event_ts", nil, []*int64{ptr(ts.UnixMilli()), nil}),
+		)
+		query := queryModel{TimeColumn: "event_ts", TimeUnit: time.Millisecond}
+		out, err := prepareTimeField(frame, query)
+		require.NoError(t, err)
+		require.Equal(t, "event_ts", out.Fields[0].Name)
+		require.Equal(t, data.FieldTypeNullableTime, out.Fields[0].Type())
+		require.Equal(t, ts, *out.Fields[0].At(0).(*time.Time))
+		require.Nil(t, out.Fields[0].At(1))
+
+		// The epoch column of the frame is left untouched.
+		require.Equal(t, data.FieldTypeNullableInt64, frame.Fields[1].Type())
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		frame := data.NewFrame("", data.NewField("ts", nil, []string{"2023"}))
+		_, err := prepareTimeField(frame, queryModel{TimeColumn: "ts"})
+		require.Error(t, err)
+	})
+}
+
+func TestEpochTime(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339Nano, "2023-01-01T00:00:00.123456789Z")
+
+	require.Equal(t, ts.Truncate(time.Second), epochTime(ts.Unix(), time.Second))
+	require.Equal(t, ts.Truncate(time.Second), epochTime(uint32(ts.Unix()), time.Second))
+	require.Equal(t, ts.Truncate(time.Millisecond), epochTime(ts.UnixMilli(), time.Millisecond))
+	require.Equal(t, ts.Truncate(time.Microsecond), epochTime(ts.UnixMicro(), time.Microsecond))
+	require.Equal(t, ts, epochTime(ts.UnixNano(), time.Nanosecond))
+	require.Equal(t, ts.Truncate(time.Second).Add(500*time.Millisecond), epochTime(float64(ts.Unix())+0.5, time.Second))
+}
+
+func TestFrameDataResponse_TimeColumn(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	frame := data.NewFrame("",
+		data.NewField("host", nil, []string{"a", "b"}),
+		data.NewField("value", nil, []float64{1, 2}),
+		data.NewField("epoch", nil, []int64{ts.Unix(), ts.Unix()}),
+	)
+	frame.Meta = &data.FrameMeta{}
+
+	query := queryModel{
+		Query:      sqlutil.Query{Format: sqlutil.FormatOptionTimeSeries},
+		TimeColumn: "epoch",
+		TimeUnit:   time.Second,
+	}
+	resp := frameDataResponse(frame, nil, query, nil)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+
+	wide := resp.Frames[0]
+	require.Equal(t, 1, wide.Rows())
+	require.Equal(t, "epoch", wide.Fields[0].Name)
+	require.Equal(t, ts, wide.Fields[0].At(0))
+	require.Len(t, wide.Fields, 3)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestFillTimeSeries(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	newFrame := func() *data.Frame {
+		return data.NewFrame("",
+			data.NewField("time", nil, []time.Time{at(0), at(10), at(40)}),
+			data.NewField("value", nil, []int64{0, 10, 40}),
+			data.NewField("host", nil, []*string{ptr("a"), nil, ptr("c")}),
+		)
+	}
+	query := queryModel{
+		Query: sqlutil.Query{
+			Interval:  10 * time.Second,
+			TimeRange: backendTimeRange(at(0), at(50)),
+		},
+	}
+
+	cs := []struct {
+		mode   fillMode
+		value  float64
+		values []*int64
+		hosts  []*string
+	}{
+		{
+			mode:   fillModeNull,
+			values: []*int64{ptr[int64](0), ptr[int64](10), nil, nil, ptr[int64](40), nil},
+			hosts:  []*string{ptr("a"), nil, nil, nil, ptr("c"), nil},
+		},
+		{
+			mode:   fillModePrevious,
+			values: []*int64{ptr[int64](0), ptr[int64](10), ptr[int64](10), ptr[int64](10), ptr[int64](40), ptr[int64](40)},
+			hosts:  []*string{ptr("a"), ptr("a"), ptr("a"), ptr("a"), ptr("c"), ptr("c")},
+		},
+		{
+			mode:   fillModeLinear,
+			values: []*int64{ptr[int64](0), ptr[int64](10), ptr[int64](20), ptr[int64](30), ptr[int64](40), nil},
+			hosts:  []*string{ptr("a"), nil, nil, nil, ptr("c"), nil},
+		},
+		{
+			mode:   fillModeValue,
+			value:  -1,
+			values: []*int64{ptr[int64](0), ptr[int64](10), ptr[int64](-1), ptr[int64](-1), ptr[int64](40), ptr[int64](-1)},
+			hosts:  []*string{ptr("a"), nil, nil, nil, ptr("c"), nil},
+		},
+	}
+	for _, c := range cs {
+		t.Run(fmt.Sprint(c.mode), func(t *testing.T) {
+			query.Fill, query.FillValue = c.mode, c.value
+			frame, err := fillTimeSeries(newFrame(), query)
+			require.NoError(t, err)
+			require.Equal(t, []time.Time{at(0), at(10), at(20), at(30), at(40), at(50)}, extractFieldValues[time.Time](t, frame.Fields[0]))
+			require.Equal(t, c.values, extractFieldValues[*int64](t, frame.Fields[1]))
+			require.Equal(t, c.hosts, extractFieldValues[*string](t, frame.Fields[2]))
+		})
+	}
+}
+
+func TestNullableValues(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{ts}),
+		data.NewField("host", nil, []string{"a"}),
+		data.NewField("value", nil, []int64{1}),
+	)
+
+	out := nullableValues(frame)
+	require.Equal(t, data.FieldTypeTime, out.Fields[0].Type())
+	require.Equal(t, data.FieldTypeString, out.Fields[1].Type())
+	require.Equal(t, []*int64{ptr[int64](1)}, extractFieldValues[*int64](t, out.Fields[2]))
+
+	// The frame itself is left untouched.
+	require.Equal(t, data.FieldTypeInt64, frame.Fields[2].Type())
+}
+
+func TestFillTimeSeries_Unaligned(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	// Rows within an interval are kept and no row is added for it.
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(3), at(25)}),
+		data.NewField("value", nil, []float64{1, 2}),
+	)
+	query := queryModel{
+		Query: sqlutil.Query{
+			Interval:  10 * time.Second,
+			TimeRange: backendTimeRange(at(5), at(29)),
+		},
+		Fill: fillModeNull,
+	}
+	frame, err := fillTimeSeries(frame, query)
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{at(3), at(10), at(25)}, extractFieldValues[time.Time](t, frame.Fields[0]))
+	require.Equal(t, []*float64{ptr(1.0), nil, ptr(2.0)}, extractFieldValues[*float64](t, frame.Fields[1]))
+}
+
+func TestFrameDataResponse_Fill(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(0), at(0), at(10)}),
+		data.NewField("host", nil, []string{"a", "b", "a"}),
+		data.NewField("value", nil, []int64{1, 2, 3}),
+	)
+	frame.Meta = &data.FrameMeta{}
+
+	query := queryModel{
+		Query: sqlutil.Query{
+			Format:    sqlutil.FormatOptionTimeSeries,
+			Interval:  10 * time.Second,
+			TimeRange: backendTimeRange(at(0), at(10)),
+		},
+		Fill: fillModePrevious,
+	}
+	resp := frameDataResponse(frame, nil, query, nil)
+	require.NoError(t, resp.Error)
+
+	wide := resp.Frames[0]
+	require.Equal(t, data.FrameTypeTimeSeriesWide, wide.Meta.Type)
+	require.Len(t, wide.Fields, 3)
+	require.Equal(t, data.Labels{"host": "b"}, wide.Fields[2].Labels)
+	// The missing value of host=b is filled rather than set to zero.
+	require.Equal(t, []*int64{ptr[int64](2), ptr[int64](2)}, extractFieldValues[*int64](t, wide.Fields[2]))
+}
+
+func backendTimeRange(from, to time.Time) backend.TimeRange {
+	return backend.TimeRange{From: from, To: to}
+}
+
+func TestSortTimeSeries(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(1), at(0), at(1), at(0)}),
+		data.NewField("host", nil, []string{"b", "b", "a", "a"}),
+		data.NewField("value", nil, []int64{1, 2, 3, 4}),
+	)
+	frame.Fields[2].Config = &data.FieldConfig{Unit: "bytes"}
+
+	sorted, err := sortTimeSeries(frame)
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{at(0), at(0), at(1), at(1)}, extractFieldValues[time.Time](t, sorted.Fields[0]))
+	require.Equal(t, []string{"a", "b", "a", "b"}, extractFieldValues[string](t, sorted.Fields[1]))
+	require.Equal(t, []int64{4, 2, 3, 1}, extractFieldValues[int64](t, sorted.Fields[2]))
+	require.Equal(t, "bytes", sorted.Fields[2].Config.Unit)
+
+	// Sorted frames are returned as is.
+	again, err := sortTimeSeries(sorted)
+	require.NoError(t, err)
+	require.Same(t, sorted, again)
+
+	// The sort is stable.
+	frame = data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(1), at(0), at(0)}),
+		data.NewField("value", nil, []int64{1, 2, 3}),
+	)
+	sorted, err = sortTimeSeries(frame)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, 3, 1}, extractFieldValues[int64](t, sorted.Fields[1]))
+
+	nullTime := data.NewFrame("",
+		data.NewField("time", nil, []*time.Time{ptr(at(0)), nil}),
+		data.NewField("value", nil, []int64{1, 2}),
+	)
+	_, err = sortTimeSeries(nullTime)
+	require.EqualError(t, err, "time column has null values")
+}
+
+func TestDedupeTimeSeries(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	newFrame := func() *data.Frame {
+		return data.NewFrame("",
+			data.NewField("time", nil, []time.Time{at(0), at(0), at(0), at(0), at(1)}),
+			data.NewField("host", nil, []string{"a", "a", "a", "b", "a"}),
+			data.NewField("value", nil, []*float64{ptr(1.0), nil, ptr(5.0), ptr(2.0), ptr(3.0)}),
+		)
+	}
+
+	cs := []struct {
+		mode   duplicateMode
+		values []*float64
+	}{
+		{mode: duplicateModeWarn, values: []*float64{ptr(5.0), ptr(2.0), ptr(3.0)}},
+		{mode: duplicateModeFirst, values: []*float64{ptr(1.0), ptr(2.0), ptr(3.0)}},
+		{mode: duplicateModeLast, values: []*float64{ptr(5.0), ptr(2.0), ptr(3.0)}},
+		{mode: duplicateModeSum, values: []*float64{ptr(6.0), ptr(2.0), ptr(3.0)}},
+		{mode: duplicateModeAvg, values: []*float64{ptr(3.0), ptr(2.0), ptr(3.0)}},
+		{mode: duplicateModeMin, values: []*float64{ptr(1.0), ptr(2.0), ptr(3.0)}},
+		{mode: duplicateModeMax, values: []*float64{ptr(5.0), ptr(2.0), ptr(3.0)}},
+	}
+	for _, c := range cs {
+		t.Run(fmt.Sprint(c.mode), func(t *testing.T) {
+			frame, err := dedupeTimeSeries(newFrame(), queryModel{Duplicates: c.mode})
+			require.NoError(t, err)
+			require.Equal(t, []time.Time{at(0), at(0), at(1)}, extractFieldValues[time.Time](t, frame.Fields[0]))
+			require.Equal(t, []string{"a", "b", "a"}, extractFieldValues[string](t, frame.Fields[1]))
+			require.Equal(t, c.values, extractFieldValues[*float64](t, frame.Fields[2]))
+
+			if c.mode == duplicateModeWarn {
+				require.Len(t, frame.Meta.Notices, 1)
+				require.Equal(t, data.NoticeSeverityWarning, frame.Meta.Notices[0].Severity)
+				require.Contains(t, frame.Meta.Notices[0].Text, "2 rows")
+				return
+			}
+			require.Nil(t, frame.Meta)
+		})
+	}
+
+	// Frames without duplicates are returned as is.
+	unique := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(0), at(0)}),
+		data.NewField("host", nil, []string{"a", "b"}),
+		data.NewField("value", nil, []int64{1, 2}),
+	)
+	frame, err := dedupeTimeSeries(unique, queryModel{})
+	require.NoError(t, err)
+	require.Same(t, unique, frame)
+}
+
+func TestFrameDataResponse_Unsorted(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	frame := data.NewFrame("",
+		data.NewField("host", nil, []string{"a", "b", "a", "a"}),
+		data.NewField("time", nil, []time.Time{at(1), at(0), at(0), at(1)}),
+		data.NewField("value", nil, []int64{1, 2, 3, 4}),
+	)
+	frame.Meta = &data.FrameMeta{}
+
+	query := queryModel{
+		Query:      sqlutil.Query{Format: sqlutil.FormatOptionTimeSeries, RawSQL: "select 1"},
+		Duplicates: duplicateModeSum,
+	}
+	resp := frameDataResponse(frame, nil, query, nil)
+	require.NoError(t, resp.Error)
+
+	wide := resp.Frames[0]
+	require.Equal(t, data.FrameTypeTimeSeriesWide, wide.Meta.Type)
+	require.Equal(t, "select 1", wide.Meta.ExecutedQueryString)
+	require.Equal(t, []time.Time{at(0), at(1)}, extractFieldValues[time.Time](t, wide.Fields[0]))
+	require.Equal(t, data.Labels{"host": "a"}, wide.Fields[1].Labels)
+	require.Equal(t, []int64{3, 5}, extractFieldValues[int64](t, wide.Fields[1]))
+	require.Equal(t, data.Labels{"host": "b"}, wide.Fields[2].Labels)
+	require.Equal(t, []int64{2, 0}, extractFieldValues[int64](t, wide.Fields[2]))
+	require.Empty(t, wide.Meta.Notices)
+}
+
+func TestSplitTimeSeries(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	frame := data.NewFrame("metrics",
+		data.NewField("time", nil, []time.Time{at(0), at(0), at(1)}),
+		data.NewField("host", nil, []string{"b", "a", "a"}),
+		data.NewField("value", nil, []*int64{ptr[int64](1), ptr[int64](2), nil}),
+		data.NewField("ok", nil, []bool{true, true, false}),
+		data.NewField("load", nil, []float32{0.5, 1, 1.5}),
+	)
+	frame.Meta = &data.FrameMeta{Notices: []data.Notice{{Text: "notice"}}}
+
+	frames := splitTimeSeries(frame)
+	require.Len(t, frames, 6)
+	for _, f := range frames {
+		require.Equal(t, "metrics", f.Name)
+		require.Equal(t, data.FrameTypeTimeSeriesMulti, f.Meta.Type)
+		require.Len(t, f.Fields, 2)
+	}
+	require.Len(t, frames[0].Meta.Notices, 1)
+	require.Empty(t, frames[1].Meta.Notices)
+
+	// Series are ordered by their labels and keep the types of their fields.
+	require.Equal(t, "value", frames[0].Fields[1].Name)
+	require.Equal(t, data.Labels{"host": "a", "ok": "false"}, frames[0].Fields[1].Labels)
+	require.Equal(t, []time.Time{at(1)}, extractFieldValues[time.Time](t, frames[0].Fields[0]))
+	require.Equal(t, []*int64{nil}, extractFieldValues[*int64](t, frames[0].Fields[1]))
+	require.Equal(t, data.Labels{"host": "a", "ok": "false"}, frames[1].Fields[1].Labels)
+	require.Equal(t, []float32{1.5}, extractFieldValues[float32](t, frames[1].Fields[1]))
+	require.Equal(t, data.Labels{"host": "a", "ok": "true"}, frames[2].Fields[1].Labels)
+	require.Equal(t, []*int64{ptr[int64](2)}, extractFieldValues[*int64](t, frames[2].Fields[1]))
+	require.Equal(t, data.Labels{"host": "b", "ok": "true"}, frames[4].Fields[1].Labels)
+	require.Equal(t, []*int64{ptr[int64](1)}, extractFieldValues[*int64](t, frames[4].Fields[1]))
+
+	// The frame itself is not modified.
+	require.Nil(t, frame.Fields[2].Labels)
+	require.Len(t, frame.Meta.Notices, 1)
+}
+
+func TestFrameDataResponse_Multi(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	at := func(s int) time.Time { return from.Add(time.Duration(s) * time.Second) }
+
+	frame := data.NewFrame("",
+		data.NewField("host", nil, []string{"a", "b", "a"}),
+		data.NewField("time", nil, []time.Time{at(10), at(0), at(0)}),
+		data.NewField("value", nil, []int64{1, 2, 3}),
+	)
+	frame.Meta = &data.FrameMeta{}
+
+	query := queryModel{
+		Query: sqlutil.Query{
+			Format:    formatOptionTimeSeriesMulti,
+			Interval:  10 * time.Second,
+			TimeRange: backendTimeRange(at(0), at(10)),
+		},
+		Fill:         fillModePrevious,
+		LegendFormat: "{{host}}",
+	}
+	resp := frameDataResponse(frame, nil, query, nil)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 2)
+
+	require.Equal(t, "time", resp.Frames[0].Fields[0].Name)
+	require.Equal(t, []*int64{ptr[int64](3), ptr[int64](1)}, extractFieldValues[*int64](t, resp.Frames[0].Fields[1]))
+	require.Equal(t, "a", resp.Frames[0].Fields[1].Config.DisplayNameFromDS)
+	// The series of host=b is filled on its own.
+	require.Equal(t, []time.Time{at(0), at(10)}, extractFieldValues[time.Time](t, resp.Frames[1].Fields[0]))
+	require.Equal(t, []*int64{ptr[int64](2), ptr[int64](2)}, extractFieldValues[*int64](t, resp.Frames[1].Fields[1]))
+	require.Equal(t, "b", resp.Frames[1].Fields[1].Config.DisplayNameFromDS)
+}
@@ -0,0 +1,304 @@
+package flightsql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// spanColumns maps the roles of the columns of span results to the
+// normalized names of the columns detected for them, in order of preference.
+// Names are normalized by [normalizeColumn].
+var spanColumns = map[string][]string{
+	"traceID":       {"traceid"},
+	"spanID":        {"spanid"},
+	"parentSpanID":  {"parentspanid", "parentid"},
+	"operationName": {"operationname", "spanname", "operation", "name"},
+	"serviceName":   {"servicename", "service"},
+	"duration":      {"duration"},
+	"endTime":       {"endtime", "end"},
+}
+
+// spanStartColumns are the normalized names of the columns detected as the
+// start time of spans when the query names no time column.
+var spanStartColumns = []string{"starttime", "start", "timestamp", "time"}
+
+// resourceColumnPrefixes are the normalized prefixes of columns holding
+// attributes of the service rather than of the span.
+var resourceColumnPrefixes = []string{"resource"}
+
+// normalizeColumn returns the name of a column in lower case without
+// separators so that `trace_id`, `traceId` and `trace.id` all match.
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", ".", "", "-", "").Replace(name))
+}
+
+// spanTag is a key/value attribute of a span in the trace frame.
+type spanTag struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// traceFrame converts span results into the frame expected by the trace view
+// with one row per span. The columns holding the trace, span and parent span
+// IDs, the operation and service names, and the duration or end time of the
+// spans are detected by their names. Durations are read in the duration unit
+// of the query. The start time of spans is the time column of the query or a
+// timestamp column detected by its name.
+// All other columns become tags of the spans, or tags of their service if
+// their names start with "resource".
+func traceFrame(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	start := queryTimeField(frame, query)
+	if field := spanColumn(frame, spanStartColumns); query.TimeColumn == "" && field != nil && isTimeField(field) {
+		start = field
+	}
+	if start == nil {
+		return nil, fmt.Errorf("no start time column found")
+	}
+
+	columns := map[string]*data.Field{}
+	for role, names := range spanColumns {
+		columns[role] = spanColumn(frame, names)
+	}
+	for _, role := range []string{"traceID", "spanID"} {
+		if columns[role] == nil {
+			return nil, fmt.Errorf("no %s column found", role)
+		}
+	}
+	if columns["duration"] == nil && (columns["endTime"] == nil || !isTimeField(columns["endTime"])) {
+		return nil, fmt.Errorf("no duration or end time column found")
+	}
+
+	var tags, serviceTags []*data.Field
+	for _, field := range frame.Fields {
+		if field == start || field.Name == query.TimeColumn || isSpanColumn(field, columns) {
+			continue
+		}
+		if isResourceColumn(field.Name) {
+			serviceTags = append(serviceTags, field)
+			continue
+		}
+		tags = append(tags, field)
+	}
+
+	unit := query.DurationUnit
+	if unit == 0 {
+		unit = time.Millisecond
+	}
+
+	out := data.NewFrame(frame.Name,
+		data.NewField("traceID", nil, []string{}),
+		data.NewField("spanID", nil, []string{}),
+		data.NewField("parentSpanID", nil, []string{}),
+		data.NewField("operationName", nil, []string{}),
+		data.NewField("serviceName", nil, []string{}),
+		data.NewField("serviceTags", nil, []json.RawMessage{}),
+		data.NewField("startTime", nil, []float64{}),
+		data.NewField("duration", nil, []float64{}),
+		data.NewField("tags", nil, []json.RawMessage{}),
+	)
+	for i := 0; i < frame.Rows(); i++ {
+		v, ok := start.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		startTime := v.(time.Time)
+
+		var duration float64
+		if field := columns["duration"]; field != nil {
+			if isNull(field, i) {
+				continue
+			}
+			d, err := field.FloatAt(i)
+			if err != nil {
+				return nil, fmt.Errorf("duration: %w", err)
+			}
+			duration = d * float64(unit) / float64(time.Millisecond)
+		} else {
+			end, ok := columns["endTime"].ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			duration = float64(end.(time.Time).Sub(startTime)) / float64(time.Millisecond)
+		}
+
+		serviceTagsJSON, err := spanTags(serviceTags, i)
+		if err != nil {
+			return nil, err
+		}
+		tagsJSON, err := spanTags(tags, i)
+		if err != nil {
+			return nil, err
+		}
+		out.AppendRow(
+			spanString(columns["traceID"], i),
+			spanString(columns["spanID"], i),
+			spanString(columns["parentSpanID"], i),
+			spanString(columns["operationName"], i),
+			spanString(columns["serviceName"], i),
+			serviceTagsJSON,
+			float64(startTime.UnixNano())/float64(time.Millisecond),
+			duration,
+			tagsJSON,
+		)
+	}
+
+	out.Meta = frame.Meta
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+	out.Meta.PreferredVisualization = data.VisTypeTrace
+	return out, nil
+}
+
+// spanColumn returns the first field of the frame whose normalized name is one
+// of names, or nil if there is none.
+func spanColumn(frame *data.Frame, names []string) *data.Field {
+	for _, name := range names {
+		for _, field := range frame.Fields {
+			if normalizeColumn(field.Name) == name {
+				return field
+			}
+		}
+	}
+	return nil
+}
+
+// isSpanColumn reports whether the field was detected as one of the span
+// columns.
+func isSpanColumn(field *data.Field, columns map[string]*data.Field) bool {
+	for _, c := range columns {
+		if c == field {
+			return true
+		}
+	}
+	return false
+}
+
+// isResourceColumn reports whether the column holds an attribute of the
+// service of a span.
+func isResourceColumn(name string) bool {
+	name = normalizeColumn(name)
+	for _, prefix := range resourceColumnPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// spanString returns the value of a span column at row i as a string. Missing
+// columns and null values are empty strings.
+func spanString(field *data.Field, i int) string {
+	if field == nil {
+		return ""
+	}
+	return labelAt(field, i)
+}
+
+// spanTags returns the non-null values of the fields at row i as a JSON array
+// of tags.
+func spanTags(fields []*data.Field, i int) (json.RawMessage, error) {
+	tags := []spanTag{}
+	for _, field := range fields {
+		if v, ok := field.ConcreteAt(i); ok {
+			tags = append(tags, spanTag{Key: field.Name, Value: v})
+		}
+	}
+	return json.Marshal(tags)
+}
+
+// nodeGraphFrames converts a trace frame into the nodes and edges frames
+// expected by the node graph. Nodes are the services of the spans, or their
+// operations if the spans have no service, and edges are the calls between
+// them given by the parent of each span. Calls within a node are not edges.
+func nodeGraphFrames(trace *data.Frame) (nodes, edges *data.Frame) {
+	type node struct {
+		spans    int64
+		duration float64
+	}
+	var (
+		nodeStats = map[string]*node{}
+		edgeCalls = map[[2]string]int64{}
+		spanNodes = map[[2]string]string{}
+	)
+
+	str := func(name string, i int) string {
+		field, _ := trace.FieldByName(name)
+		return field.At(i).(string)
+	}
+	nodeAt := func(i int) string {
+		if service := str("serviceName", i); service != "" {
+			return service
+		}
+		return str("operationName", i)
+	}
+	durations, _ := trace.FieldByName("duration")
+
+	for i := 0; i < trace.Rows(); i++ {
+		id := nodeAt(i)
+		if nodeStats[id] == nil {
+			nodeStats[id] = &node{}
+		}
+		nodeStats[id].spans++
+		nodeStats[id].duration += durations.At(i).(float64)
+
+		span := [2]string{str("traceID", i), str("spanID", i)}
+		spanNodes[span] = id
+	}
+	for i := 0; i < trace.Rows(); i++ {
+		parent := [2]string{str("traceID", i), str("parentSpanID", i)}
+		source, ok := spanNodes[parent]
+		if !ok {
+			continue
+		}
+		if target := nodeAt(i); source != target {
+			edgeCalls[[2]string{source, target}]++
+		}
+	}
+
+	ids := make([]string, 0, len(nodeStats))
+	for id := range nodeStats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	nodes = data.NewFrame("nodes",
+		data.NewField("id", nil, []string{}),
+		data.NewField("title", nil, []string{}),
+		data.NewField("mainstat", nil, []float64{}).SetConfig(&data.FieldConfig{DisplayName: "Average duration", Unit: "ms"}),
+		data.NewField("secondarystat", nil, []int64{}).SetConfig(&data.FieldConfig{DisplayName: "Spans"}),
+	)
+	for _, id := range ids {
+		stats := nodeStats[id]
+		nodes.AppendRow(id, id, stats.duration/float64(stats.spans), stats.spans)
+	}
+
+	calls := make([][2]string, 0, len(edgeCalls))
+	for e := range edgeCalls {
+		calls = append(calls, e)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i][0] != calls[j][0] {
+			return calls[i][0] < calls[j][0]
+		}
+		return calls[i][1] < calls[j][1]
+	})
+	edges = data.NewFrame("edges",
+		data.NewField("id", nil, []string{}),
+		data.NewField("source", nil, []string{}),
+		data.NewField("target", nil, []string{}),
+		data.NewField("mainstat", nil, []int64{}).SetConfig(&data.FieldConfig{DisplayName: "Calls"}),
+	)
+	for _, e := range calls {
+		edges.AppendRow(e[0]+"->"+e[1], e[0], e[1], edgeCalls[e])
+	}
+
+	nodes.Meta = trace.Meta
+	nodes.Meta.PreferredVisualization = data.VisTypeNodeGraph
+	edges.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeNodeGraph}
+	return nodes, edges
+}
@@ -0,0 +1,166 @@
+package flightsql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceFrame(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	ms := float64(start.UnixMilli())
+
+	t.Run("detect", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("trace_id", nil, []string{"t1", "t1"}),
+			data.NewField("spanId", nil, []string{"s1", "s2"}),
+			data.NewField("parent.id", nil, []*string{nil, ptr("s1")}),
+			data.NewField("name", nil, []string{"GET /", "select"}),
+			data.NewField("service_name", nil, []string{"api", "db"}),
+			data.NewField("start_time", nil, []time.Time{start, start.Add(time.Millisecond)}),
+			data.NewField("duration", nil, []int64{20, 5}),
+			data.NewField("resource.host", nil, []string{"a", "b"}),
+			data.NewField("http.status", nil, []*int64{ptr[int64](200), nil}),
+		)
+
+		out, err := traceFrame(frame, queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, data.VisType(data.VisTypeTrace), out.Meta.PreferredVisualization)
+		require.Equal(t, []string{"t1", "t1"}, extractFieldValues[string](t, out.Fields[0]))
+		require.Equal(t, []string{"s1", "s2"}, extractFieldValues[string](t, out.Fields[1]))
+		require.Equal(t, []string{"", "s1"}, extractFieldValues[string](t, out.Fields[2]))
+		require.Equal(t, []string{"GET /", "select"}, extractFieldValues[string](t, out.Fields[3]))
+		require.Equal(t, []string{"api", "db"}, extractFieldValues[string](t, out.Fields[4]))
+		require.Equal(t, []json.RawMessage{
+			json.RawMessage(`[{"key":"resource.host","value":"a"}]`),
+			json.RawMessage(`[{"key":"resource.host","value":"b"}]`),
+		}, extractFieldValues[json.RawMessage](t, out.Fields[5]))
+		require.Equal(t, []float64{ms, ms + 1}, extractFieldValues[float64](t, out.Fields[6]))
+		require.Equal(t, []float64{20, 5}, extractFieldValues[float64](t, out.Fields[7]))
+		require.Equal(t, []json.RawMessage{
+			json.RawMessage(`[{"key":"http.status","value":200}]`),
+			json.RawMessage(`[]`),
+		}, extractFieldValues[json.RawMessage](t, out.Fields[8]))
+	})
+
+	t.Run("duration unit", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("traceid", nil, []string{"t1"}),
+			data.NewField("spanid", nil, []string{"s1"}),
+			data.NewField("ts", nil, []int64{start.Unix()}),
+			data.NewField("duration", nil, []int64{1500}),
+		)
+
+		out, err := traceFrame(frame, queryModel{TimeColumn: "ts", TimeUnit: time.Second, DurationUnit: time.Microsecond})
+		require.NoError(t, err)
+		require.Equal(t, []float64{ms}, extractFieldValues[float64](t, out.Fields[6]))
+		require.Equal(t, []float64{1.5}, extractFieldValues[float64](t, out.Fields[7]))
+		require.Equal(t, []json.RawMessage{json.RawMessage(`[]`)}, extractFieldValues[json.RawMessage](t, out.Fields[8]))
+	})
+
+	t.Run("end time", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("end_time", nil, []time.Time{start.Add(3 * time.Second)}),
+			data.NewField("start_time", nil, []time.Time{start}),
+			data.NewField("trace_id", nil, []string{"t1"}),
+			data.NewField("span_id", nil, []string{"s1"}),
+		)
+
+		out, err := traceFrame(frame, queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, []float64{ms}, extractFieldValues[float64](t, out.Fields[6]))
+		require.Equal(t, []float64{3000}, extractFieldValues[float64](t, out.Fields[7]))
+	})
+
+	t.Run("missing columns", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("time", nil, []time.Time{start}),
+			data.NewField("trace_id", nil, []string{"t1"}),
+		)
+		_, err := traceFrame(frame, queryModel{})
+		require.EqualError(t, err, "no spanID column found")
+
+		frame.Fields = append(frame.Fields, data.NewField("span_id", nil, []string{"s1"}))
+		_, err = traceFrame(frame, queryModel{})
+		require.EqualError(t, err, "no duration or end time column found")
+	})
+}
+
+func TestNodeGraphFrames(t *testing.T) {
+	trace := data.NewFrame("",
+		data.NewField("traceID", nil, []string{"t1", "t1", "t1", "t1"}),
+		data.NewField("spanID", nil, []string{"s1", "s2", "s3", "s4"}),
+		data.NewField("parentSpanID", nil, []string{"", "s1", "s2", "s1"}),
+		data.NewField("operationName", nil, []string{"GET /", "query", "select", "cache"}),
+		data.NewField("serviceName", nil, []string{"api", "db", "db", ""}),
+		data.NewField("serviceTags", nil, []json.RawMessage{nil, nil, nil, nil}),
+		data.NewField("startTime", nil, []float64{0, 0, 0, 0}),
+		data.NewField("duration", nil, []float64{30, 10, 4, 2}),
+		data.NewField("tags", nil, []json.RawMessage{nil, nil, nil, nil}),
+	)
+	trace.Meta = &data.FrameMeta{}
+
+	nodes, edges := nodeGraphFrames(trace)
+	require.Equal(t, data.VisType(data.VisTypeNodeGraph), nodes.Meta.PreferredVisualization)
+	require.Equal(t, data.VisType(data.VisTypeNodeGraph), edges.Meta.PreferredVisualization)
+
+	require.Equal(t, []string{"api", "cache", "db"}, extractFieldValues[string](t, nodes.Fields[0]))
+	require.Equal(t, []float64{30, 2, 7}, extractFieldValues[float64](t, nodes.Fields[2]))
+	require.Equal(t, []int64{1, 1, 2}, extractFieldValues[int64](t, nodes.Fields[3]))
+
+	// The call from db to db is within a node.
+	require.Equal(t, []string{"api->cache", "api->db"}, extractFieldValues[string](t, edges.Fields[0]))
+	require.Equal(t, []string{"api", "api"}, extractFieldValues[string](t, edges.Fields[1]))
+	require.Equal(t, []string{"cache", "db"}, extractFieldValues[string](t, edges.Fields[2]))
+	require.Equal(t, []int64{1, 1}, extractFieldValues[int64](t, edges.Fields[3]))
+}
+
+// spansTable creates a table of the spans of a trace with start holding the
+// start time as milliseconds since the epoch and duration in microseconds.
+var spansTable = []string{
+	`create table spans (trace_id text, span_id text, parent_span_id text, name text, service text, start integer, duration integer)`,
+	`insert into spans values
+	('t1', 's1', null, 'GET /', 'api', 1672531200000, 30000),
+	('t1', 's2', 's1', 'select', 'db', 1672531200005, 10000)`,
+}
+
+func TestIntegration_QueryData_Trace(t *testing.T) {
+	ds := newTestDatasource(t, config{}, spansTable...)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	query := queryRequest{
+		RefID:        "A",
+		Text:         "select * from spans",
+		Format:       "trace",
+		TimeColumn:   "start",
+		TimeUnit:     "ms",
+		DurationUnit: "us",
+	}
+
+	resp := queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	require.Equal(t, []float64{30, 10}, extractFieldValues[float64](t, resp.Frames[0].Fields[7]))
+
+	query.Format = "node_graph"
+	query.LegendFormat = "{{__field}}"
+	query.FieldConfig = map[string]fieldOptions{"mainstat": {Unit: "s"}}
+	resp = queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 2)
+	require.Equal(t, []string{"api->db"}, extractFieldValues[string](t, resp.Frames[1].Fields[0]))
+	// Frame options do not override the display of the node graph fields.
+	mainstat, _ := resp.Frames[0].FieldByName("mainstat")
+	require.Equal(t, "Average duration", mainstat.Config.DisplayName)
+	require.Empty(t, mainstat.Config.DisplayNameFromDS)
+	require.Equal(t, "ms", mainstat.Config.Unit)
+
+	query.DurationUnit = "weeks"
+	resp = queryDataResponse(t, ds, query, tr)
+	require.EqualError(t, resp.Error, `unsupported duration unit: "weeks"`)
+}
@@ -0,0 +1,311 @@
+package flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxResourceQueryBytes bounds the size of the body of resource requests
+// about a query.
+const maxResourceQueryBytes = 1 << 20
+
+// resourceQuery is the body of resource requests about a query: the JSON of a
+// [queryRequest] along with the time range its macros are expanded for, in
+// milliseconds since the epoch. The time range defaults to the last hour.
+type resourceQuery struct {
+	FromMilliseconds int64 `json:"from"`
+	ToMilliseconds   int64 `json:"to"`
+}
+
+// decodeResourceQuery decodes the query in the body of a resource request the
+// way [decodeQueryRequest] decodes the queries of [backend.QueryDataRequest]s.
+// The query request is returned along with the query so that errors can be
+// located in its text.
+func (d *FlightSQLDatasource) decodeResourceQuery(ctx context.Context, body []byte) (*queryModel, queryRequest, error) {
+	var (
+		rq resourceQuery
+		q  queryRequest
+	)
+	if err := json.Unmarshal(body, &rq); err != nil {
+		return nil, q, fmt.Errorf("unmarshal json: %w", err)
+	}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil, q, fmt.Errorf("unmarshal json: %w", err)
+	}
+
+	tr := backend.TimeRange{
+		From: time.UnixMilli(rq.FromMilliseconds).UTC(),
+		To:   time.UnixMilli(rq.ToMilliseconds).UTC(),
+	}
+	if rq.FromMilliseconds == 0 && rq.ToMilliseconds == 0 {
+		tr.To = time.Now().UTC()
+		tr.From = tr.To.Add(-time.Hour)
+	}
+	query, err := decodeQueryRequest(backend.DataQuery{
+		RefID:     q.RefID,
+		JSON:      body,
+		TimeRange: tr,
+	}, func() string { return d.identifierQuote(ctx) })
+	return query, q, err
+}
+
+// validateRequest is the body of a validate request, a [resourceQuery] which
+// asks for the plan of the query as text or as a frame with explain.
+type validateRequest struct {
+	Explain string `json:"explain"`
+}
+
+// validateResponse is the response to a validate request.
+type validateResponse struct {
+	Valid bool `json:"valid"`
+	// SQL is the query with its macros expanded.
+	SQL   string         `json:"sql,omitempty"`
+	Error *validateError `json:"error,omitempty"`
+	// Statements holds the schemas of the statements of the query.
+	Statements []statementSchemas `json:"statements,omitempty"`
+	// Plan is the plan of the query as text.
+	Plan string `json:"plan,omitempty"`
+	// PlanFrames holds the plan of the query as frames.
+	PlanFrames data.Frames `json:"planFrames,omitempty"`
+}
+
+// validateError locates the reason a query is invalid.
+type validateError struct {
+	Message string `json:"message"`
+	// Macro is the macro that failed to expand, if any.
+	Macro string `json:"macro,omitempty"`
+	// Statement is the index of the statement that failed, if the query has
+	// more than one.
+	Statement *int `json:"statement,omitempty"`
+	// Line and Column locate the error in the text of the query for macro
+	// errors, or in the expanded SQL of the statement for SQL errors. They
+	// start at 1 and are omitted if the error could not be located.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// statementSchemas holds the schemas of a prepared statement. Servers that do
+// not report them return no fields.
+type statementSchemas struct {
+	Parameters []schemaField `json:"parameters"`
+	Fields     []schemaField `json:"fields"`
+}
+
+type schemaField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// postValidate checks a query without running it. Its macros are expanded and
+// its statements are prepared, which returns their parameter and result
+// schemas. The plan of the query is also returned if the request asks for it.
+// Invalid queries are reported in the response rather than by its status.
+func (d *FlightSQLDatasource) postValidate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxResourceQueryBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req validateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Explain != "" && req.Explain != "text" && req.Explain != "frame" {
+		http.Error(w, fmt.Sprintf("unsupported explain format: %q", req.Explain), http.StatusBadRequest)
+		return
+	}
+
+	resp := d.validate(ctx, body, req)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (d *FlightSQLDatasource) validate(ctx context.Context, body []byte, req validateRequest) validateResponse {
+	query, q, err := d.decodeResourceQuery(ctx, body)
+	if err != nil {
+		return validateResponse{Error: macroError(q, err, d.identifierQuote(ctx))}
+	}
+	resp := validateResponse{SQL: query.RawSQL}
+
+	statements := splitStatements(query.RawSQL)
+	ctx = metadata.NewOutgoingContext(ctx, d.md)
+	for i, stmt := range statements {
+		schemas, err := d.prepare(ctx, stmt.Text)
+		if err != nil {
+			resp.Error = sqlError(stmt.Text, err)
+			if len(statements) > 1 {
+				resp.Error.Statement = &i
+			}
+			return resp
+		}
+		resp.Statements = append(resp.Statements, schemas)
+	}
+
+	if req.Explain != "" {
+		for i, stmt := range statements {
+			frame, _, err := d.queryFrame(ctx, "explain "+stmt.Text)
+			if frame == nil || err != nil {
+				resp.Error = sqlError(stmt.Text, err)
+				if len(statements) > 1 {
+					resp.Error.Statement = &i
+				}
+				return resp
+			}
+			if req.Explain == "frame" {
+				resp.PlanFrames = append(resp.PlanFrames, frame)
+				continue
+			}
+			if resp.Plan != "" {
+				resp.Plan += "\n\n"
+			}
+			resp.Plan += planText(frame)
+		}
+	}
+
+	resp.Valid = true
+	return resp
+}
+
+// prepare prepares a statement and returns its schemas.
+func (d *FlightSQLDatasource) prepare(ctx context.Context, sql string) (statementSchemas, error) {
+	prep, err := d.client.Prepare(ctx, sql)
+	if err != nil {
+		return statementSchemas{}, err
+	}
+	defer func() {
+		if err := prep.Close(ctx); err != nil {
+			logErrorf("Failed to close prepared statement: %s", err)
+		}
+	}()
+	return statementSchemas{
+		Parameters: schemaFields(prep.ParameterSchema()),
+		Fields:     schemaFields(prep.DatasetSchema()),
+	}, nil
+}
+
+func schemaFields(schema *arrow.Schema) []schemaField {
+	fields := []schemaField{}
+	if schema == nil {
+		return fields
+	}
+	for _, f := range schema.Fields() {
+		fields = append(fields, schemaField{Name: f.Name, Type: f.Type.String(), Nullable: f.Nullable})
+	}
+	return fields
+}
+
+// planText returns the rows of an EXPLAIN frame as lines of tab separated
+// values.
+func planText(frame *data.Frame) string {
+	lines := make([]string, frame.Rows())
+	for i := range lines {
+		values := make([]string, len(frame.Fields))
+		for j, field := range frame.Fields {
+			values[j] = labelAt(field, i)
+		}
+		lines[i] = strings.Join(values, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// macroCall matches the start of a macro in the text of a query.
+var macroCall = regexp.MustCompile(`\$__(\w+)`)
+
+// macroError locates the error of a query that failed to decode. Macros in the
+// text of the query are expanded one at a time and the first one failing is
+// reported. Errors not caused by a macro are reported without a location.
+func macroError(q queryRequest, err error, quote string) *validateError {
+	verr := &validateError{Message: err.Error()}
+	query := sqlutil.Query{
+		Interval: time.Duration(q.IntervalMilliseconds) * time.Millisecond,
+	}
+	for _, loc := range macroCall.FindAllStringSubmatchIndex(q.Text, -1) {
+		name := q.Text[loc[2]:loc[3]]
+		call := q.Text[loc[0]:loc[1]]
+		if strings.HasPrefix(q.Text[loc[1]:], "(") {
+			if _, end, ok := listMacroArgs(q.Text[loc[1]+1:]); ok {
+				call = q.Text[loc[0] : loc[1]+1+end]
+			} else {
+				call = q.Text[loc[0]:]
+			}
+		}
+
+		var err error
+		switch {
+		case name == "adhocFilters":
+			_, err = expandAdhocFilters(call, q.AdhocFilters, quote)
+		case listMacro.MatchString(call):
+			_, err = expandListMacros(query.WithSQL(call), macros)
+		default:
+			_, err = sqlutil.Interpolate(query.WithSQL(call), macros)
+		}
+		if err != nil {
+			verr.Message = err.Error()
+			verr.Macro = "$__" + name
+			verr.Line, verr.Column = textPosition(q.Text, loc[0])
+			return verr
+		}
+	}
+	return verr
+}
+
+// sqlErrorPositions match the locations servers give in errors: a line and
+// column, a 1-based character position, or the token an error is near.
+var (
+	sqlErrorLineColumn = regexp.MustCompile(`(?i)line:? (\d+),? col(?:umn)?:? (\d+)`)
+	sqlErrorPosition   = regexp.MustCompile(`(?i)(?:position|at character):? (\d+)`)
+	sqlErrorNear       = regexp.MustCompile(`(?i)near "([^"]+)"`)
+)
+
+// sqlError locates the error of a statement that failed to prepare in the
+// statement, if the error gives its location.
+func sqlError(sql string, err error) *validateError {
+	if err == nil {
+		return &validateError{Message: "statement could not be executed"}
+	}
+	verr := &validateError{Message: err.Error()}
+	msg := err.Error()
+	if m := sqlErrorLineColumn.FindStringSubmatch(msg); m != nil {
+		verr.Line, _ = strconv.Atoi(m[1])
+		verr.Column, _ = strconv.Atoi(m[2])
+	} else if m := sqlErrorPosition.FindStringSubmatch(msg); m != nil {
+		if pos, _ := strconv.Atoi(m[1]); pos > 0 && pos <= len(sql) {
+			verr.Line, verr.Column = textPosition(sql, pos-1)
+		}
+	} else if m := sqlErrorNear.FindStringSubmatch(msg); m != nil {
+		if i := strings.Index(sql, m[1]); i != -1 {
+			verr.Line, verr.Column = textPosition(sql, i)
+		}
+	}
+	return verr
+}
+
+// textPosition returns the line and column, both starting at 1, of the byte at
+// offset in text.
+func textPosition(text string, offset int) (line, column int) {
+	before := text[:offset]
+	line = strings.Count(before, "\n") + 1
+	column = offset - strings.LastIndex(before, "\n")
+	return line, column
+}
@@ -0,0 +1,100 @@
+package flightsql
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMacroError(t *testing.T) {
+	q := queryRequest{Text: "select *\nfrom t\nwhere $__timeFilter(ts) and $__in(a, 'b\n"}
+	verr := macroError(q, errors.New("macro interpolation: failed"), defaultIdentifierQuote)
+	require.Equal(t, "$__in", verr.Macro)
+	require.Equal(t, 3, verr.Line)
+	require.Equal(t, 29, verr.Column)
+
+	q = queryRequest{Text: "select $__timeGroup(ts)"}
+	verr = macroError(q, errors.New("macro interpolation: failed"), defaultIdentifierQuote)
+	require.Equal(t, "$__timeGroup", verr.Macro)
+	require.Equal(t, 1, verr.Line)
+	require.Equal(t, 8, verr.Column)
+
+	q = queryRequest{Text: "select 1"}
+	verr = macroError(q, errors.New("unmarshal json: failed"), defaultIdentifierQuote)
+	require.Equal(t, &validateError{Message: "unmarshal json: failed"}, verr)
+}
+
+func TestSQLError(t *testing.T) {
+	for _, tc := range []struct {
+		sql, err     string
+		line, column int
+	}{
+		{"select 1", "syntax error at line 3, column 7", 3, 7},
+		{"select\n  1 +", "syntax error at position 12", 2, 5},
+		{"select\n  frm t", `near "frm": syntax error`, 2, 3},
+		{"select 1", "table not found", 0, 0},
+	} {
+		verr := sqlError(tc.sql, errors.New(tc.err))
+		require.Equal(t, tc.err, verr.Message)
+		require.Equal(t, tc.line, verr.Line, tc.err)
+		require.Equal(t, tc.column, verr.Column, tc.err)
+	}
+}
+
+func TestPlanText(t *testing.T) {
+	frame := data.NewFrame("",
+		data.NewField("id", nil, []int64{1, 2}),
+		data.NewField("detail", nil, []string{"SCAN t", "USE INDEX i"}),
+	)
+	require.Equal(t, "1\tSCAN t\n2\tUSE INDEX i", planText(frame))
+}
+
+func TestIntegration_Validate(t *testing.T) {
+	ds := newTestDatasource(t, config{})
+
+	validate := func(body string) validateResponse {
+		w := httptest.NewRecorder()
+		ds.postValidate(w, httptest.NewRequest(http.MethodPost, "/flightsql/validate", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp validateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := validate(`{"queryText": "select * from intTable where $__in(value, 1, 2)"}`)
+	require.True(t, resp.Valid, resp.Error)
+	require.Equal(t, "select * from intTable where value in (1, 2)", resp.SQL)
+	require.Len(t, resp.Statements, 1)
+	require.Empty(t, resp.Plan)
+
+	// The SQLite server prepares statements lazily, so syntax errors are only
+	// found when explaining them.
+	resp = validate(`{"queryText": "select 1;\nselec 2", "explain": "text"}`)
+	require.False(t, resp.Valid)
+	require.NotNil(t, resp.Error)
+	require.Equal(t, 1, *resp.Error.Statement)
+	require.Equal(t, 1, resp.Error.Line)
+	require.Equal(t, 1, resp.Error.Column)
+
+	resp = validate(`{"queryText": "select\n  $__timeGroup(ts)\nfrom intTable"}`)
+	require.False(t, resp.Valid)
+	require.Equal(t, "$__timeGroup", resp.Error.Macro)
+	require.Equal(t, 2, resp.Error.Line)
+	require.Equal(t, 3, resp.Error.Column)
+
+	resp = validate(`{"queryText": "select * from intTable", "explain": "frame"}`)
+	require.True(t, resp.Valid, resp.Error)
+	require.Len(t, resp.PlanFrames, 1)
+	_, opcode := resp.PlanFrames[0].FieldByName("opcode")
+	require.NotEqual(t, -1, opcode)
+
+	w := httptest.NewRecorder()
+	ds.postValidate(w, httptest.NewRequest(http.MethodPost, "/flightsql/validate", strings.NewReader(`{"explain": "json"}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
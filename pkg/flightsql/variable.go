@@ -0,0 +1,142 @@
+package flightsql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// maxVariableValues bounds the number of values returned by a variable query.
+const maxVariableValues = 1000
+
+// Variable text and value columns are detected by these names, as in the SQL
+// datasources of Grafana.
+const (
+	variableTextColumn  = "__text"
+	variableValueColumn = "__value"
+)
+
+// variableSorts maps the sort orders accepted in variable queries to a
+// function reporting whether a value sorts before another. The empty order
+// keeps the values in the order of the results.
+var variableSorts = map[string]func(a, b string) bool{
+	"":     nil,
+	"asc":  func(a, b string) bool { return a < b },
+	"desc": func(a, b string) bool { return a > b },
+}
+
+// variableFrame converts the results of a variable query into a frame of
+// text and value fields.
+//
+// The text and value are read from the columns named __text and __value if
+// present, and otherwise from the first and second columns. Results with a
+// single column use it for both. Values are converted to strings and rows
+// with a null text are dropped.
+//
+// If the query has a regex, only values whose text matches it are kept. A
+// capture group named text or value replaces the text or value, and an
+// unnamed capture group replaces both. Values are then de-duplicated by value,
+// keeping the first, sorted if the query asks for it, and limited to
+// [maxVariableValues] with a notice if there are more.
+func variableFrame(frame *data.Frame, query queryModel) (*data.Frame, error) {
+	texts, values := variableColumns(frame)
+	if texts == nil {
+		return nil, fmt.Errorf("variable queries must return at least one column")
+	}
+
+	var (
+		seen = map[string]bool{}
+		rows [][2]string
+	)
+	for i := 0; i < frame.Rows(); i++ {
+		if isNull(texts, i) {
+			continue
+		}
+		text, value := labelAt(texts, i), labelAt(values, i)
+		if query.VariableRegex != nil {
+			var ok bool
+			if text, value, ok = matchVariable(query.VariableRegex, text, value); !ok {
+				continue
+			}
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		rows = append(rows, [2]string{text, value})
+	}
+
+	if less := variableSorts[query.VariableSort]; less != nil {
+		sort.SliceStable(rows, func(i, j int) bool { return less(rows[i][0], rows[j][0]) })
+	}
+	limited := len(rows) > maxVariableValues
+	if limited {
+		rows = rows[:maxVariableValues]
+	}
+
+	out := data.NewFrame(frame.Name, data.NewField("text", nil, []string{}), data.NewField("value", nil, []string{}))
+	for _, row := range rows {
+		out.AppendRow(row[0], row[1])
+	}
+	out.Meta = frame.Meta
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+	if limited {
+		out.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Variable values have been limited to %d", maxVariableValues),
+		})
+	}
+	return out, nil
+}
+
+// variableColumns returns the text and value fields of the results of a
+// variable query. Both are nil if the results have no columns.
+func variableColumns(frame *data.Frame) (texts, values *data.Field) {
+	if len(frame.Fields) == 0 {
+		return nil, nil
+	}
+	texts, _ = frame.FieldByName(variableTextColumn)
+	values, _ = frame.FieldByName(variableValueColumn)
+	switch {
+	case texts != nil && values != nil:
+	case texts != nil:
+		values = texts
+	case values != nil:
+		texts = values
+	case len(frame.Fields) > 1:
+		texts, values = frame.Fields[0], frame.Fields[1]
+	default:
+		texts, values = frame.Fields[0], frame.Fields[0]
+	}
+	return texts, values
+}
+
+// matchVariable applies the regex of a variable query to the text of a value.
+// It reports whether the text matches and returns the text and value
+// replaced by the capture groups of the regex.
+func matchVariable(re *regexp.Regexp, text, value string) (string, string, bool) {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return "", "", false
+	}
+	if len(m) < 2 {
+		return text, value, true
+	}
+	var named bool
+	for i, name := range re.SubexpNames()[1:] {
+		switch name {
+		case "text":
+			text, named = m[i+1], true
+		case "value":
+			value, named = m[i+1], true
+		}
+	}
+	if !named {
+		text, value = m[1], m[1]
+	}
+	return text, value, true
+}
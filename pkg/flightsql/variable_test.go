@@ -0,0 +1,115 @@
+package flightsql
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariableFrame(t *testing.T) {
+	t.Run("one column", func(t *testing.T) {
+		frame := data.NewFrame("", data.NewField("host", nil, []*string{ptr("b"), nil, ptr("a"), ptr("b")}))
+
+		out, err := variableFrame(frame, queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"b", "a"}, extractFieldValues[string](t, out.Fields[0]))
+		require.Equal(t, []string{"b", "a"}, extractFieldValues[string](t, out.Fields[1]))
+	})
+
+	t.Run("two columns", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("name", nil, []string{"web", "db", "cache"}),
+			data.NewField("id", nil, []int64{3, 1, 2}),
+		)
+
+		out, err := variableFrame(frame, queryModel{VariableSort: "asc"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"cache", "db", "web"}, extractFieldValues[string](t, out.Fields[0]))
+		require.Equal(t, []string{"2", "1", "3"}, extractFieldValues[string](t, out.Fields[1]))
+
+		out, err = variableFrame(frame, queryModel{VariableSort: "desc"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"web", "db", "cache"}, extractFieldValues[string](t, out.Fields[0]))
+	})
+
+	t.Run("named columns", func(t *testing.T) {
+		frame := data.NewFrame("",
+			data.NewField("__value", nil, []string{"1", "2"}),
+			data.NewField("other", nil, []string{"x", "y"}),
+			data.NewField("__text", nil, []string{"one", "two"}),
+		)
+
+		out, err := variableFrame(frame, queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"one", "two"}, extractFieldValues[string](t, out.Fields[0]))
+		require.Equal(t, []string{"1", "2"}, extractFieldValues[string](t, out.Fields[1]))
+	})
+
+	t.Run("regex", func(t *testing.T) {
+		frame := data.NewFrame("", data.NewField("host", nil, []string{"web-1.eu", "web-2.us", "db-1.eu"}))
+
+		out, err := variableFrame(frame, queryModel{VariableRegex: regexp.MustCompile(`^web`)})
+		require.NoError(t, err)
+		require.Equal(t, []string{"web-1.eu", "web-2.us"}, extractFieldValues[string](t, out.Fields[1]))
+
+		out, err = variableFrame(frame, queryModel{VariableRegex: regexp.MustCompile(`\.(\w+)$`)})
+		require.NoError(t, err)
+		require.Equal(t, []string{"eu", "us"}, extractFieldValues[string](t, out.Fields[0]))
+		require.Equal(t, []string{"eu", "us"}, extractFieldValues[string](t, out.Fields[1]))
+
+		out, err = variableFrame(frame, queryModel{VariableRegex: regexp.MustCompile(`^(?P<text>\w+)-(?P<value>\d)`)})
+		require.NoError(t, err)
+		// Values are de-duplicated after the regex is applied.
+		require.Equal(t, []string{"web", "web"}, extractFieldValues[string](t, out.Fields[0]))
+		require.Equal(t, []string{"1", "2"}, extractFieldValues[string](t, out.Fields[1]))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		values := make([]int64, maxVariableValues+1)
+		for i := range values {
+			values[i] = int64(i)
+		}
+		frame := data.NewFrame("", data.NewField("n", nil, values))
+
+		out, err := variableFrame(frame, queryModel{})
+		require.NoError(t, err)
+		require.Equal(t, maxVariableValues, out.Rows())
+		require.Len(t, out.Meta.Notices, 1)
+	})
+
+	t.Run("no columns", func(t *testing.T) {
+		_, err := variableFrame(data.NewFrame(""), queryModel{})
+		require.EqualError(t, err, "variable queries must return at least one column")
+	})
+}
+
+func TestIntegration_QueryData_Variable(t *testing.T) {
+	ds := newTestDatasource(t, config{}, logsTable...)
+
+	from, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	query := queryRequest{
+		RefID:        "A",
+		Text:         "select service from logs",
+		QueryType:    string(queryTypeVariable),
+		VariableSort: "asc",
+	}
+
+	resp := queryDataResponse(t, ds, query, tr)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	require.Equal(t, []string{"api", "db"}, extractFieldValues[string](t, resp.Frames[0].Fields[0]))
+
+	query.VariableRegex = "("
+	resp = queryDataResponse(t, ds, query, tr)
+	require.ErrorContains(t, resp.Error, "variable regex")
+
+	query.VariableRegex = ""
+	query.VariableSort = "random"
+	resp = queryDataResponse(t, ds, query, tr)
+	require.EqualError(t, resp.Error, `unsupported variable sort: "random"`)
+}
@@ -39,10 +39,10 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
       if (table?.value) {
         res = table?.value && (await datasource.getColumns(table?.value))
       }
-      const columns = res?.frames[0].schema.fields.map((t: any) => ({
+      const columns = res?.frames[0].data.values[0].map((name: string) => ({
         index: '',
-        label: t.name,
-        value: t.name,
+        label: name,
+        value: name,
       }))
       setColumns(columns)
     })()
@@ -23,13 +23,13 @@ export function QueryEditor(props: QueryEditorProps<FlightSQLDataSource, SQLQuer
   useEffect(() => {
     ;(async () => {
       const res = await datasource.getSQLInfo()
-      const keywords = res?.frames[0].data.values[1][17]
-      const numericFunctions = res?.frames[0].data.values[1][18]
-      const stringFunctions = res?.frames[0].data.values[1][19]
-      const systemFunctions = res?.frames[0].data.values[1][20]
-      const sqlDateTimeFunctions = res?.frames[0].data.values[1][21]
-      const functions = [...numericFunctions, ...stringFunctions, ...systemFunctions, ...sqlDateTimeFunctions]
-      setSqlInfo({keywords: keywords, builtinFunctions: functions})
+      const functions = [
+        ...(res?.sql_numeric_functions ?? []),
+        ...(res?.sql_string_functions ?? []),
+        ...(res?.sql_system_functions ?? []),
+        ...(res?.sql_datetime_functions ?? []),
+      ]
+      setSqlInfo({keywords: res?.sql_keywords, builtinFunctions: functions})
     })()
   }, [datasource])
 
@@ -37,8 +37,14 @@ export function QueryEditor(props: QueryEditorProps<FlightSQLDataSource, SQLQuer
     ;(async () => {
       const res = await datasource.getMacros()
       const prefix = `$__`
-      const macroArr = res?.macros.map((m: any) => prefix.concat(m))
-      const macros = macroArr.map((m: any) => ({text: m, name: m, id: m, type: MacroType.Value, args: []}))
+      const macros = res?.macros.map((m: any) => ({
+        text: prefix.concat(m.name),
+        name: prefix.concat(m.name),
+        id: prefix.concat(m.name),
+        type: MacroType.Value,
+        args: m.args.map((a: any) => a.name),
+        description: `${m.signature}: ${m.description}\n\n${m.example}\n=> ${m.preview}`,
+      }))
       setMacros(macros)
     })()
   }, [datasource])
@@ -56,7 +62,7 @@ export function QueryEditor(props: QueryEditorProps<FlightSQLDataSource, SQLQuer
       if (table?.value) {
         res = await datasource.getColumns(table?.value)
       }
-      return res?.frames[0].schema.fields
+      return res?.frames[0].data.values[0].map((name: string) => ({name}))
     },
     [datasource]
   )
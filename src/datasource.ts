@@ -78,7 +78,7 @@ async metricFindQuery(queryText: string, options?: any): Promise<MetricFindValue
   }
 
   getColumns(table: string): Promise<any> {
-    return this.getResource(`/flightsql/columns?table=${table}`)
+    return this.getResource(`/flightsql/columns?table=${encodeURIComponent(table)}`)
   }
 
   getMacros(): Promise<any> {